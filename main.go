@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -33,12 +34,14 @@ type CallTarget struct {
 	Name string
 	Base string
 	Attr string
+	Node *sitter.Node
 }
 
 type CallResolution struct {
 	Module string
 	Class  string
 	Func   string
+	Async  bool
 }
 
 type ClassRef struct {
@@ -47,16 +50,20 @@ type ClassRef struct {
 }
 
 type ModuleInfo struct {
-	ModulePath    string
-	FilePath      string
-	Tree          *sitter.Tree
-	IsPackage     bool
-	ModuleImports map[string]string
-	FromImports   map[string]ImportFromTarget
-	Functions     map[string]*sitter.Node
-	Classes       map[string]map[string]*sitter.Node
-	ClassBases    map[string][]string
-	Source        []byte
+	ModulePath        string
+	FilePath          string
+	Tree              *sitter.Tree
+	IsPackage         bool
+	ModuleImports     map[string]string
+	FromImports       map[string]ImportFromTarget
+	Functions         map[string][]*sitter.Node
+	Classes           map[string]map[string][]*sitter.Node
+	ClassBases        map[string][]string
+	ClassDecorators   map[string][]string
+	Properties        map[string]map[string]struct{}
+	ClassAttrs        map[string]map[string]*sitter.Node
+	Source            []byte
+	IsSQLAlchemyModel func(ModelRef) bool
 }
 
 func getRoot() string {
@@ -328,6 +335,130 @@ func isModelModule(modulePath string) bool {
 	return false
 }
 
+func isModelClass(isSQLAlchemyModel func(ModelRef) bool, modulePath string, name string) bool {
+	if isModelModule(modulePath) {
+		return true
+	}
+	return isSQLAlchemyModel != nil && isSQLAlchemyModel(ModelRef{Module: modulePath, Name: name})
+}
+
+func newSQLAlchemyModelCheck(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) func(ModelRef) bool {
+	derived := map[ClassRef]bool{}
+	var derives func(ref ClassRef, depth int) bool
+	derives = func(ref ClassRef, depth int) bool {
+		if result, ok := derived[ref]; ok {
+			return result
+		}
+		if _, ok := moduleMap[ref.Module]; !ok || depth > 8 {
+			return false
+		}
+		info, err := getModuleInfo(ref.Module)
+		if err != nil || info == nil {
+			return false
+		}
+		derived[ref] = false
+		result := isDeclarativeBase(ref.Name, info)
+		for _, base := range info.ClassBases[ref.Name] {
+			if result {
+				break
+			}
+			result = derives(resolveBaseReference(base, info, moduleMap), depth+1)
+		}
+		derived[ref] = result
+		return result
+	}
+	return func(model ModelRef) bool {
+		ref := ClassRef{Module: model.Module, Name: model.Name}
+		if !derives(ref, 0) {
+			return false
+		}
+		info, err := getModuleInfo(ref.Module)
+		if err != nil || info == nil || isDeclarativeBase(ref.Name, info) {
+			return false
+		}
+		value, abstract := info.ClassAttrs[ref.Name]["__abstract__"]
+		return !abstract || nodeText(info.Source, value) != "True"
+	}
+}
+
+func isDeclarativeBase(name string, info *ModuleInfo) bool {
+	for _, base := range info.ClassBases[name] {
+		if base == "DeclarativeBase" || base == "DeclarativeBaseNoMeta" || strings.HasSuffix(base, ".DeclarativeBase") || strings.HasSuffix(base, ".DeclarativeBaseNoMeta") {
+			return true
+		}
+	}
+	for _, decorator := range info.ClassDecorators[name] {
+		if strings.Contains(decorator, "as_declarative") {
+			return true
+		}
+	}
+	if info.Tree == nil {
+		return false
+	}
+	factories := map[string]struct{}{"declarative_base": {}, "generate_base": {}}
+	if strings.HasSuffix(name, ".Model") {
+		name = strings.TrimSuffix(name, ".Model")
+		factories = map[string]struct{}{"SQLAlchemy": {}}
+	}
+	found := false
+	walk(info.Tree.RootNode(), func(n *sitter.Node) {
+		if found || !isAssignmentNode(n) {
+			return
+		}
+		left, right := assignmentSides(n)
+		call := unwrapCallNode(right)
+		if left == nil || call == nil || nodeText(info.Source, left) != name {
+			return
+		}
+		if chain := attributeChain(call.ChildByFieldName("function"), info.Source); len(chain) > 0 {
+			_, found = factories[chain[len(chain)-1]]
+		}
+	})
+	return found
+}
+
+func resolveBaseReference(text string, info *ModuleInfo, moduleMap map[string]string) ClassRef {
+	prefix, rest := text, ""
+	if idx := strings.Index(text, "."); idx >= 0 {
+		prefix, rest = text[:idx], text[idx+1:]
+	}
+	join := func(name string) string {
+		if rest == "" {
+			return name
+		}
+		return name + "." + rest
+	}
+	if target, ok := info.FromImports[prefix]; ok {
+		if _, ok := moduleMap[target.Module+"."+target.Name]; ok && rest != "" {
+			return ClassRef{Module: target.Module + "." + target.Name, Name: rest}
+		}
+		return ClassRef{Module: target.Module, Name: join(target.Name)}
+	}
+	if modulePath, ok := info.ModuleImports[prefix]; ok && rest != "" {
+		return ClassRef{Module: modulePath, Name: rest}
+	}
+	return ClassRef{Module: info.ModulePath, Name: text}
+}
+
+func newModuleLoader(moduleMap map[string]string) func(string) (*ModuleInfo, error) {
+	moduleCache := map[string]*ModuleInfo{}
+	var isSQLAlchemyModel func(ModelRef) bool
+	load := func(path string) (*ModuleInfo, error) {
+		if info, ok := moduleCache[path]; ok {
+			return info, nil
+		}
+		info, err := parseModule(path, moduleMap[path])
+		if err != nil {
+			return nil, err
+		}
+		info.IsSQLAlchemyModel = isSQLAlchemyModel
+		moduleCache[path] = info
+		return info, nil
+	}
+	isSQLAlchemyModel = newSQLAlchemyModelCheck(moduleMap, load)
+	return load
+}
+
 func parseModule(modulePath string, filePath string) (*ModuleInfo, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
@@ -338,16 +469,19 @@ func parseModule(modulePath string, filePath string) (*ModuleInfo, error) {
 	tree := parser.Parse(nil, content)
 
 	info := &ModuleInfo{
-		ModulePath:    modulePath,
-		FilePath:      filePath,
-		Tree:          tree,
-		IsPackage:     filepath.Base(filePath) == "__init__.py",
-		ModuleImports: map[string]string{},
-		FromImports:   map[string]ImportFromTarget{},
-		Functions:     map[string]*sitter.Node{},
-		Classes:       map[string]map[string]*sitter.Node{},
-		ClassBases:    map[string][]string{},
-		Source:        content,
+		ModulePath:      modulePath,
+		FilePath:        filePath,
+		Tree:            tree,
+		IsPackage:       filepath.Base(filePath) == "__init__.py",
+		ModuleImports:   map[string]string{},
+		FromImports:     map[string]ImportFromTarget{},
+		Functions:       map[string][]*sitter.Node{},
+		Classes:         map[string]map[string][]*sitter.Node{},
+		ClassBases:      map[string][]string{},
+		ClassDecorators: map[string][]string{},
+		Properties:      map[string]map[string]struct{}{},
+		ClassAttrs:      map[string]map[string]*sitter.Node{},
+		Source:          content,
 	}
 
 	collectDefinitions(info)
@@ -359,8 +493,8 @@ func parseModule(modulePath string, filePath string) (*ModuleInfo, error) {
 
 func collectDefinitions(info *ModuleInfo) {
 	root := info.Tree.RootNode()
-	var walk func(node *sitter.Node, currentClass string)
-	walk = func(node *sitter.Node, currentClass string) {
+	var walk func(node *sitter.Node, scope string, currentClass string)
+	walk = func(node *sitter.Node, scope string, currentClass string) {
 		if node == nil {
 			return
 		}
@@ -368,26 +502,27 @@ func collectDefinitions(info *ModuleInfo) {
 		case "decorated_definition":
 			def := node.ChildByFieldName("definition")
 			if def != nil {
-				walk(def, currentClass)
+				walk(def, scope, currentClass)
 				return
 			}
 		case "class_definition":
 			nameNode := node.ChildByFieldName("name")
 			className := ""
 			if nameNode != nil {
-				className = nodeText(info.Source, nameNode)
+				className = qualifiedName(scope, nodeText(info.Source, nameNode))
 			}
 			if className != "" {
 				if _, ok := info.Classes[className]; !ok {
-					info.Classes[className] = map[string]*sitter.Node{}
+					info.Classes[className] = map[string][]*sitter.Node{}
 				}
 				if _, ok := info.ClassBases[className]; !ok {
 					info.ClassBases[className] = parseClassBases(node, info.Source)
+					info.ClassDecorators[className] = functionDecorators(node, info.Source)
 				}
 			}
 			for i := 0; i < int(node.ChildCount()); i++ {
 				child := node.Child(i)
-				walk(child, className)
+				walk(child, className, className)
 			}
 			return
 		case "function_definition":
@@ -397,22 +532,156 @@ func collectDefinitions(info *ModuleInfo) {
 				if name != "" {
 					if currentClass != "" {
 						if _, ok := info.Classes[currentClass]; !ok {
-							info.Classes[currentClass] = map[string]*sitter.Node{}
+							info.Classes[currentClass] = map[string][]*sitter.Node{}
+						}
+						switch kind, prop := propertyDecoratorKind(node, info.Source); kind {
+						case "getter":
+							if _, ok := info.Properties[currentClass]; !ok {
+								info.Properties[currentClass] = map[string]struct{}{}
+							}
+							info.Properties[currentClass][name] = struct{}{}
+						case "setter", "deleter":
+							accessor := propertyAccessorName(prop, kind)
+							if prop == name {
+								name = accessor
+							} else {
+								info.Classes[currentClass][accessor] = append(info.Classes[currentClass][accessor], node)
+							}
 						}
-						info.Classes[currentClass][name] = node
+						info.Classes[currentClass][name] = append(info.Classes[currentClass][name], node)
+						name = currentClass + "." + name
 					} else {
-						info.Functions[name] = node
+						name = qualifiedName(scope, name)
+						info.Functions[name] = append(info.Functions[name], node)
+					}
+					for i := 0; i < int(node.ChildCount()); i++ {
+						child := node.Child(i)
+						walk(child, name+".<locals>", "")
+					}
+					return
+				}
+			}
+		case "assignment":
+			if currentClass != "" {
+				left := node.ChildByFieldName("left")
+				right := node.ChildByFieldName("right")
+				if left != nil && right != nil && left.Type() == "identifier" {
+					if _, ok := info.ClassAttrs[currentClass]; !ok {
+						info.ClassAttrs[currentClass] = map[string]*sitter.Node{}
 					}
+					info.ClassAttrs[currentClass][nodeText(info.Source, left)] = right
 				}
 			}
 		}
 
 		for i := 0; i < int(node.ChildCount()); i++ {
 			child := node.Child(i)
-			walk(child, currentClass)
+			walk(child, scope, currentClass)
+		}
+	}
+	walk(root, "", "")
+}
+
+func qualifiedName(scope string, name string) string {
+	if scope == "" || name == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func resolveScopedFunction(moduleInfo *ModuleInfo, scope string, name string) (string, bool) {
+	return resolveScopedName(scope, name, func(candidate string) bool {
+		_, ok := moduleInfo.Functions[candidate]
+		return ok
+	})
+}
+
+func resolveScopedClass(moduleInfo *ModuleInfo, scope string, name string) (string, bool) {
+	return resolveScopedName(scope, name, func(candidate string) bool {
+		_, ok := moduleInfo.Classes[candidate]
+		return ok
+	})
+}
+
+func resolveScopedName(scope string, name string, defined func(string) bool) (string, bool) {
+	for scope != "" {
+		candidate := scope + ".<locals>." + name
+		if defined(candidate) {
+			return candidate, true
+		}
+		idx := strings.LastIndex(scope, ".<locals>.")
+		if idx < 0 {
+			break
+		}
+		scope = scope[:idx]
+	}
+	if defined(name) {
+		return name, true
+	}
+	return "", false
+}
+
+func enclosingClassName(moduleInfo *ModuleInfo, qualname string) string {
+	for {
+		idx := strings.LastIndex(qualname, ".<locals>.")
+		if idx < 0 {
+			return ""
+		}
+		qualname = qualname[:idx]
+		if dot := strings.LastIndex(qualname, "."); dot > 0 {
+			if _, ok := moduleInfo.Classes[qualname[:dot]]; ok {
+				return qualname[:dot]
+			}
+		}
+	}
+}
+
+func functionDecorators(functionNode *sitter.Node, source []byte) []string {
+	if functionNode == nil {
+		return nil
+	}
+	parent := functionNode.Parent()
+	if parent == nil || parent.Type() != "decorated_definition" {
+		return nil
+	}
+	decorators := []string{}
+	for i := 0; i < int(parent.ChildCount()); i++ {
+		child := parent.Child(i)
+		if child == nil || child.Type() != "decorator" {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(nodeText(source, child)), "@"))
+		if text != "" {
+			decorators = append(decorators, text)
+		}
+	}
+	return decorators
+}
+
+func propertyDecoratorKind(functionNode *sitter.Node, source []byte) (string, string) {
+	for _, decorator := range functionDecorators(functionNode, source) {
+		switch decorator {
+		case "property", "cached_property", "functools.cached_property":
+			return "getter", ""
 		}
+		if strings.HasSuffix(decorator, ".cached_property") {
+			return "getter", ""
+		}
+		if idx := strings.LastIndex(decorator, "."); idx > 0 {
+			switch decorator[idx+1:] {
+			case "setter", "deleter":
+				return decorator[idx+1:], decorator[:idx]
+			}
+		}
+	}
+	return "", ""
+}
+
+func propertyAccessorName(name string, kind string) string {
+	if kind == "" || kind == "getter" {
+		return name
 	}
-	walk(root, "")
+	return name + "." + kind
 }
 
 type importAlias struct {
@@ -580,7 +849,7 @@ func analyzeFunctionModels(functionNode *sitter.Node, moduleInfo *ModuleInfo, mo
 	for name := range usage.Names {
 		if target, ok := fromImports[name]; ok {
 			modulePath := target.Module
-			if isModelModule(modulePath) {
+			if isModelClass(moduleInfo.IsSQLAlchemyModel, modulePath, target.Name) {
 				models[ModelRef{Module: modulePath, Name: target.Name}] = struct{}{}
 			}
 		}
@@ -590,19 +859,19 @@ func analyzeFunctionModels(functionNode *sitter.Node, moduleInfo *ModuleInfo, mo
 		base := item[0]
 		attr := item[1]
 		if modulePath, ok := moduleImports[base]; ok {
-			if isModelModule(modulePath) {
+			if isModelClass(moduleInfo.IsSQLAlchemyModel, modulePath, attr) {
 				models[ModelRef{Module: modulePath, Name: attr}] = struct{}{}
 			}
 			continue
 		}
 		if target, ok := fromImports[base]; ok {
 			modulePath := target.Module + "." + target.Name
-			if isModelModule(modulePath) {
-				if _, ok := moduleMap[modulePath]; ok {
+			if _, ok := moduleMap[modulePath]; ok {
+				if isModelClass(moduleInfo.IsSQLAlchemyModel, modulePath, attr) {
 					models[ModelRef{Module: modulePath, Name: attr}] = struct{}{}
-				} else if isModelModule(target.Module) {
-					models[ModelRef{Module: target.Module, Name: target.Name}] = struct{}{}
 				}
+			} else if isModelClass(moduleInfo.IsSQLAlchemyModel, target.Module, target.Name) {
+				models[ModelRef{Module: target.Module, Name: target.Name}] = struct{}{}
 			}
 		}
 	}
@@ -610,32 +879,43 @@ func analyzeFunctionModels(functionNode *sitter.Node, moduleInfo *ModuleInfo, mo
 	return models
 }
 
-func collectLocalVariableTypes(functionNode *sitter.Node, moduleInfo *ModuleInfo, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) map[string]map[ClassRef]struct{} {
+func collectLocalVariableTypes(functionNode *sitter.Node, moduleInfo *ModuleInfo, scope string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) map[string]map[ClassRef]struct{} {
 	moduleImports, fromImports := collectScopedImports(functionNode, moduleInfo)
 	localTypes := map[string]map[ClassRef]struct{}{}
+	querySets := map[string]ClassRef{}
 
 	var walkScoped func(node *sitter.Node)
 	walkScoped = func(node *sitter.Node) {
 		if node == nil {
 			return
 		}
-		if node != functionNode {
-			switch node.Type() {
-			case "function_definition", "class_definition", "lambda":
-				return
-			}
+		if node != functionNode && isNestedScope(node) {
+			return
 		}
 		if isAssignmentNode(node) {
 			left, right := assignmentSides(node)
 			if left != nil && right != nil {
 				name := assignmentTargetName(left, moduleInfo.Source)
 				if name != "" {
-					if classRef, ok := resolveAssignedClass(right, moduleInfo, moduleImports, fromImports, moduleMap, getModuleInfo); ok {
+					if classRef, ok := resolveAssignedClass(right, moduleInfo, scope, moduleImports, fromImports, moduleMap, getModuleInfo); ok {
 						addLocalType(localTypes, name, classRef)
+					} else if classRef, ok := resolveQuerySetClass(right, moduleInfo, scope, fromImports, moduleMap, getModuleInfo); ok {
+						querySets[name] = classRef
 					}
 				}
 			}
 		}
+		if node.Type() == "for_statement" || node.Type() == "for_in_clause" {
+			left := node.ChildByFieldName("left")
+			right := node.ChildByFieldName("right")
+			if left != nil && right != nil && left.Type() == "identifier" {
+				if classRef, ok := querySets[nodeText(moduleInfo.Source, right)]; ok && right.Type() == "identifier" {
+					addLocalType(localTypes, nodeText(moduleInfo.Source, left), classRef)
+				} else if classRef, ok := resolveQuerySetClass(right, moduleInfo, scope, fromImports, moduleMap, getModuleInfo); ok {
+					addLocalType(localTypes, nodeText(moduleInfo.Source, left), classRef)
+				}
+			}
+		}
 		for i := 0; i < int(node.ChildCount()); i++ {
 			child := node.Child(i)
 			walkScoped(child)
@@ -715,7 +995,7 @@ func assignmentTargetName(node *sitter.Node, source []byte) string {
 	return ""
 }
 
-func resolveAssignedClass(node *sitter.Node, moduleInfo *ModuleInfo, moduleImports map[string]string, fromImports map[string]ImportFromTarget, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ClassRef, bool) {
+func resolveAssignedClass(node *sitter.Node, moduleInfo *ModuleInfo, scope string, moduleImports map[string]string, fromImports map[string]ImportFromTarget, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ClassRef, bool) {
 	callNode := unwrapCallNode(node)
 	if callNode == nil {
 		return ClassRef{}, false
@@ -727,15 +1007,18 @@ func resolveAssignedClass(node *sitter.Node, moduleInfo *ModuleInfo, moduleImpor
 	switch fnNode.Type() {
 	case "identifier":
 		name := nodeText(moduleInfo.Source, fnNode)
-		return resolveClassIdentifier(name, moduleInfo, fromImports, moduleMap, getModuleInfo)
+		return resolveClassIdentifier(name, moduleInfo, scope, fromImports, moduleMap, getModuleInfo)
 	case "attribute":
 		obj := fnNode.ChildByFieldName("object")
 		attr := fnNode.ChildByFieldName("attribute")
 		if obj == nil || attr == nil || obj.Type() != "identifier" || attr.Type() != "identifier" {
-			return ClassRef{}, false
+			break
 		}
 		base := nodeText(moduleInfo.Source, obj)
 		attrName := nodeText(moduleInfo.Source, attr)
+		if qualname, ok := resolveScopedClass(moduleInfo, scope, base+"."+attrName); ok {
+			return ClassRef{Module: moduleInfo.ModulePath, Name: qualname}, true
+		}
 		if modulePath, ok := moduleImports[base]; ok {
 			if classExists(modulePath, attrName, moduleInfo, moduleMap, getModuleInfo) {
 				return ClassRef{Module: modulePath, Name: attrName}, true
@@ -750,20 +1033,68 @@ func resolveAssignedClass(node *sitter.Node, moduleInfo *ModuleInfo, moduleImpor
 			}
 		}
 		if attrName == "create" {
-			if classRef, ok := resolveClassIdentifier(base, moduleInfo, fromImports, moduleMap, getModuleInfo); ok {
+			if classRef, ok := resolveClassIdentifier(base, moduleInfo, scope, fromImports, moduleMap, getModuleInfo); ok {
 				return classRef, true
 			}
 		}
 	}
+	chain := attributeChain(fnNode, moduleInfo.Source)
+	if len(chain) >= 3 {
+		if _, ok := instanceQueryOps[chain[len(chain)-1]]; ok {
+			return resolveClassIdentifier(chain[0], moduleInfo, scope, fromImports, moduleMap, getModuleInfo)
+		}
+	}
 	return ClassRef{}, false
 }
 
-func resolveClassIdentifier(name string, moduleInfo *ModuleInfo, fromImports map[string]ImportFromTarget, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ClassRef, bool) {
+var instanceQueryOps = map[string]struct{}{
+	"get":      {},
+	"first":    {},
+	"last":     {},
+	"earliest": {},
+	"latest":   {},
+	"create":   {},
+}
+
+var querySetOps = map[string]struct{}{
+	"all":               {},
+	"filter":            {},
+	"exclude":           {},
+	"order_by":          {},
+	"select_related":    {},
+	"prefetch_related":  {},
+	"distinct":          {},
+	"only":              {},
+	"defer":             {},
+	"annotate":          {},
+	"reverse":           {},
+	"select_for_update": {},
+	"using":             {},
+	"iterator":          {},
+	"none":              {},
+}
+
+func resolveQuerySetClass(node *sitter.Node, moduleInfo *ModuleInfo, scope string, fromImports map[string]ImportFromTarget, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ClassRef, bool) {
+	callNode := unwrapCallNode(node)
+	if callNode == nil {
+		return ClassRef{}, false
+	}
+	chain := attributeChain(callNode, moduleInfo.Source)
+	if len(chain) < 3 {
+		return ClassRef{}, false
+	}
+	if _, ok := querySetOps[chain[len(chain)-1]]; !ok {
+		return ClassRef{}, false
+	}
+	return resolveClassIdentifier(chain[0], moduleInfo, scope, fromImports, moduleMap, getModuleInfo)
+}
+
+func resolveClassIdentifier(name string, moduleInfo *ModuleInfo, scope string, fromImports map[string]ImportFromTarget, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ClassRef, bool) {
 	if name == "" {
 		return ClassRef{}, false
 	}
-	if _, ok := moduleInfo.Classes[name]; ok {
-		return ClassRef{Module: moduleInfo.ModulePath, Name: name}, true
+	if qualname, ok := resolveScopedClass(moduleInfo, scope, name); ok {
+		return ClassRef{Module: moduleInfo.ModulePath, Name: qualname}, true
 	}
 	if target, ok := fromImports[name]; ok {
 		if !classExists(target.Module, target.Name, moduleInfo, moduleMap, getModuleInfo) {
@@ -834,7 +1165,7 @@ func collectUsage(functionNode *sitter.Node, source []byte) usageInfo {
 		Names: map[string]struct{}{},
 		Attrs: make([][2]string, 0),
 	}
-	walk(functionNode, func(n *sitter.Node) {
+	walkScope(functionNode, func(n *sitter.Node) {
 		switch n.Type() {
 		case "attribute":
 			obj := n.ChildByFieldName("object")
@@ -875,7 +1206,7 @@ func shouldCountIdentifier(node *sitter.Node) bool {
 
 func analyzeFunctionCalls(functionNode *sitter.Node, source []byte) []CallTarget {
 	calls := []CallTarget{}
-	walk(functionNode, func(n *sitter.Node) {
+	walkScope(functionNode, func(n *sitter.Node) {
 		if n.Type() != "call" {
 			return
 		}
@@ -885,7 +1216,7 @@ func analyzeFunctionCalls(functionNode *sitter.Node, source []byte) []CallTarget
 		}
 		switch fnNode.Type() {
 		case "identifier":
-			calls = append(calls, CallTarget{Kind: "name", Name: nodeText(source, fnNode)})
+			calls = append(calls, CallTarget{Kind: "name", Name: nodeText(source, fnNode), Node: n})
 		case "attribute":
 			obj := fnNode.ChildByFieldName("object")
 			attr := fnNode.ChildByFieldName("attribute")
@@ -893,11 +1224,11 @@ func analyzeFunctionCalls(functionNode *sitter.Node, source []byte) []CallTarget
 				return
 			}
 			if obj.Type() == "identifier" {
-				calls = append(calls, CallTarget{Kind: "attr", Base: nodeText(source, obj), Attr: nodeText(source, attr)})
+				calls = append(calls, CallTarget{Kind: "attr", Base: nodeText(source, obj), Attr: nodeText(source, attr), Node: n})
 				return
 			}
 			if obj.Type() == "attribute" {
-				calls = append(calls, CallTarget{Kind: "attr", Base: nodeText(source, obj), Attr: nodeText(source, attr)})
+				calls = append(calls, CallTarget{Kind: "attr", Base: nodeText(source, obj), Attr: nodeText(source, attr), Node: n})
 				return
 			}
 			if obj.Type() == "call" {
@@ -907,12 +1238,12 @@ func analyzeFunctionCalls(functionNode *sitter.Node, source []byte) []CallTarget
 				}
 				switch innerFn.Type() {
 				case "identifier":
-					calls = append(calls, CallTarget{Kind: "ctor", Base: nodeText(source, innerFn), Attr: nodeText(source, attr)})
+					calls = append(calls, CallTarget{Kind: "ctor", Base: nodeText(source, innerFn), Attr: nodeText(source, attr), Node: n})
 				case "attribute":
 					innerObj := innerFn.ChildByFieldName("object")
 					innerAttr := innerFn.ChildByFieldName("attribute")
 					if innerObj != nil && innerAttr != nil && innerObj.Type() == "identifier" && innerAttr.Type() == "identifier" {
-						calls = append(calls, CallTarget{Kind: "ctor_attr", Base: nodeText(source, innerObj), Attr: nodeText(source, innerAttr), Name: nodeText(source, attr)})
+						calls = append(calls, CallTarget{Kind: "ctor_attr", Base: nodeText(source, innerObj), Attr: nodeText(source, innerAttr), Name: nodeText(source, attr), Node: n})
 					}
 				}
 			}
@@ -921,17 +1252,215 @@ func analyzeFunctionCalls(functionNode *sitter.Node, source []byte) []CallTarget
 	return calls
 }
 
-func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[string]string, currentClass string, getModuleInfo func(string) (*ModuleInfo, error), localTypes map[string]map[ClassRef]struct{}) []CallResolution {
+func analyzePropertyAccesses(functionNode *sitter.Node, source []byte) []CallTarget {
+	accesses := []CallTarget{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "attribute" {
+			return
+		}
+		obj := n.ChildByFieldName("object")
+		attr := n.ChildByFieldName("attribute")
+		if obj == nil || attr == nil || obj.Type() != "identifier" || attr.Type() != "identifier" {
+			return
+		}
+		parent := n.Parent()
+		if parent != nil && parent.Type() == "call" && fieldName(parent, n) == "function" {
+			return
+		}
+		base := nodeText(source, obj)
+		name := nodeText(source, attr)
+		read, write := attributeAccessMode(n)
+		if read {
+			accesses = append(accesses, CallTarget{Kind: "property_get", Base: base, Attr: name, Node: n})
+		}
+		if write {
+			accesses = append(accesses, CallTarget{Kind: "property_set", Base: base, Attr: name, Node: n})
+		}
+	})
+	return accesses
+}
+
+func attributeAccessMode(node *sitter.Node) (bool, bool) {
+	current := node
+	parent := node.Parent()
+	for parent != nil {
+		switch parent.Type() {
+		case "pattern_list", "tuple_pattern", "list_pattern":
+			current = parent
+			parent = parent.Parent()
+			continue
+		}
+		break
+	}
+	if parent == nil || fieldName(parent, current) != "left" {
+		return true, false
+	}
+	switch parent.Type() {
+	case "assignment":
+		return false, true
+	case "augmented_assignment":
+		return true, true
+	}
+	return true, false
+}
+
+func resolvePropertyTargets(classRef ClassRef, attr string, kind string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []CallResolution {
+	if classRef.Module == "" || classRef.Name == "" || getModuleInfo == nil {
+		return nil
+	}
+	class, ok := resolveClassDefinition(classRef, moduleMap, getModuleInfo, 0)
+	if !ok {
+		return nil
+	}
+	return propertyAccessor(class, attr, kind, moduleMap, getModuleInfo, 0)
+}
+
+func propertyAccessor(class classDefinition, attr string, kind string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) []CallResolution {
+	if depth > 8 {
+		return nil
+	}
+	if _, ok := class.Info.Properties[class.Name][attr]; ok {
+		accessor := attr
+		if kind == "property_set" {
+			accessor = propertyAccessorName(attr, "setter")
+		}
+		if _, ok := class.Info.Classes[class.Name][accessor]; ok {
+			return []CallResolution{{Module: class.Info.ModulePath, Class: class.Name, Func: accessor}}
+		}
+	}
+	for _, base := range class.Info.ClassBases[class.Name] {
+		if parent, ok := resolveClassReference(base, class.Info, moduleMap, getModuleInfo); ok {
+			if targets := propertyAccessor(parent, attr, kind, moduleMap, getModuleInfo, depth+1); len(targets) > 0 {
+				return targets
+			}
+		}
+	}
+	return nil
+}
+
+var celeryInvocationAttrs = map[string]struct{}{
+	"delay":       {},
+	"apply_async": {},
+	"apply":       {},
+	"s":           {},
+	"si":          {},
+	"signature":   {},
+	"map":         {},
+	"starmap":     {},
+	"chunks":      {},
+}
+
+func isCeleryTaskDecorator(decorator string, info *ModuleInfo, getModuleInfo func(string) (*ModuleInfo, error)) bool {
+	if idx := strings.Index(decorator, "("); idx >= 0 {
+		decorator = decorator[:idx]
+	}
+	decorator = strings.TrimSpace(decorator)
+	if importedName(decorator, info) == "celery.shared_task" {
+		return true
+	}
+	app, ok := strings.CutSuffix(decorator, ".task")
+	return ok && isCeleryApp(app, info, getModuleInfo)
+}
+
+func isCeleryApp(name string, info *ModuleInfo, getModuleInfo func(string) (*ModuleInfo, error)) bool {
+	if importedName(name, info) == "celery.current_app" {
+		return true
+	}
+	appInfo, appName := info, name
+	modulePath := ""
+	if target, ok := info.FromImports[name]; ok {
+		modulePath, appName = target.Module, target.Name
+	} else if idx := strings.LastIndex(name, "."); idx > 0 {
+		if path, ok := info.ModuleImports[name[:idx]]; ok {
+			modulePath, appName = path, name[idx+1:]
+		}
+	}
+	if modulePath != "" {
+		if getModuleInfo == nil {
+			return false
+		}
+		targetInfo, err := getModuleInfo(modulePath)
+		if err != nil || targetInfo == nil {
+			return false
+		}
+		appInfo = targetInfo
+	}
+	for _, value := range moduleLevelValues(appInfo, appName) {
+		if value.Type() == "call" && importedName(nodeText(appInfo.Source, value.ChildByFieldName("function")), appInfo) == "celery.Celery" {
+			return true
+		}
+	}
+	return false
+}
+
+func isCeleryTask(functionNodes []*sitter.Node, info *ModuleInfo, getModuleInfo func(string) (*ModuleInfo, error)) bool {
+	for _, node := range functionNodes {
+		for _, decorator := range functionDecorators(node, info.Source) {
+			if isCeleryTaskDecorator(decorator, info, getModuleInfo) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func resolveCeleryTask(base string, moduleInfo *ModuleInfo, moduleMap map[string]string, currentScope string, getModuleInfo func(string) (*ModuleInfo, error)) (CallResolution, bool) {
+	target, targetInfo, ok := resolveFunctionReference(base, moduleInfo, moduleMap, currentScope, getModuleInfo)
+	if !ok || !isCeleryTask(targetInfo.Functions[target.Func], targetInfo, getModuleInfo) {
+		return CallResolution{}, false
+	}
+	target.Async = true
+	return target, true
+}
+
+func resolveFunctionReference(text string, moduleInfo *ModuleInfo, moduleMap map[string]string, currentScope string, getModuleInfo func(string) (*ModuleInfo, error)) (CallResolution, *ModuleInfo, bool) {
+	if name, ok := resolveScopedFunction(moduleInfo, currentScope, text); ok {
+		return CallResolution{Module: moduleInfo.ModulePath, Func: name}, moduleInfo, true
+	}
+	if getModuleInfo == nil {
+		return CallResolution{}, nil, false
+	}
+	modulePath := ""
+	funcName := ""
+	if target, ok := moduleInfo.FromImports[text]; ok {
+		modulePath = target.Module
+		funcName = target.Name
+	} else if idx := strings.LastIndex(text, "."); idx > 0 {
+		prefix := text[:idx]
+		funcName = text[idx+1:]
+		if path, ok := moduleInfo.ModuleImports[prefix]; ok {
+			modulePath = path
+		} else if target, ok := moduleInfo.FromImports[prefix]; ok {
+			modulePath = target.Module + "." + target.Name
+		}
+	}
+	if modulePath == "" || funcName == "" {
+		return CallResolution{}, nil, false
+	}
+	if _, ok := moduleMap[modulePath]; !ok {
+		return CallResolution{}, nil, false
+	}
+	targetInfo, err := getModuleInfo(modulePath)
+	if err != nil || targetInfo == nil {
+		return CallResolution{}, nil, false
+	}
+	if _, ok := targetInfo.Functions[funcName]; !ok {
+		return CallResolution{}, nil, false
+	}
+	return CallResolution{Module: modulePath, Func: funcName}, targetInfo, true
+}
+
+func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[string]string, currentClass string, currentScope string, getModuleInfo func(string) (*ModuleInfo, error), localTypes map[string]map[ClassRef]struct{}) []CallResolution {
 	targets := []CallResolution{}
 	if call.Kind == "name" && call.Name != "" {
-		if fn, ok := moduleInfo.Functions[call.Name]; ok && fn != nil {
-			return []CallResolution{{Module: moduleInfo.ModulePath, Func: call.Name}}
+		if name, ok := resolveScopedFunction(moduleInfo, currentScope, call.Name); ok {
+			return []CallResolution{{Module: moduleInfo.ModulePath, Func: name}}
 		}
 		if target, ok := moduleInfo.FromImports[call.Name]; ok {
 			if _, ok := moduleMap[target.Module]; ok {
 				if getModuleInfo != nil {
 					if targetInfo, err := getModuleInfo(target.Module); err == nil && targetInfo != nil {
-						if fn, ok := targetInfo.Functions[target.Name]; ok && fn != nil {
+						if fns, ok := targetInfo.Functions[target.Name]; ok && len(fns) > 0 {
 							return []CallResolution{{Module: target.Module, Func: target.Name}}
 						}
 						if _, ok := targetInfo.Classes[target.Name]; ok {
@@ -946,6 +1475,13 @@ func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[s
 	}
 
 	if call.Kind == "attr" && call.Base != "" && call.Attr != "" {
+		if _, ok := celeryInvocationAttrs[call.Attr]; ok {
+			if target, ok := resolveCeleryTask(call.Base, moduleInfo, moduleMap, currentScope, getModuleInfo); ok {
+				// apply() runs the task in the calling process.
+				target.Async = call.Attr != "apply"
+				return []CallResolution{target}
+			}
+		}
 		if refs, ok := localTypes[call.Base]; ok {
 			for classRef := range refs {
 				if classRef.Module == "" || classRef.Name == "" {
@@ -987,28 +1523,52 @@ func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[s
 			}
 		}
 		if modulePath, ok := moduleInfo.ModuleImports[call.Base]; ok {
-			if _, ok := moduleMap[modulePath]; ok {
+			if _, ok := moduleMap[modulePath]; ok && !classExists(modulePath, call.Attr, moduleInfo, moduleMap, getModuleInfo) {
 				targets = append(targets, CallResolution{Module: modulePath, Func: call.Attr})
 			}
 		}
 		if target, ok := moduleInfo.FromImports[call.Base]; ok {
 			modulePath := target.Module + "." + target.Name
-			if _, ok := moduleMap[modulePath]; ok {
+			if _, ok := moduleMap[modulePath]; ok && !classExists(modulePath, call.Attr, moduleInfo, moduleMap, getModuleInfo) {
 				targets = append(targets, CallResolution{Module: modulePath, Func: call.Attr})
 			}
 		}
-		if methods, ok := moduleInfo.Classes[call.Base]; ok {
-			if _, ok := methods[call.Attr]; ok {
-				targets = append(targets, CallResolution{Module: moduleInfo.ModulePath, Class: call.Base, Func: call.Attr})
+		if className, ok := resolveScopedClass(moduleInfo, currentScope, call.Base); ok {
+			if _, ok := moduleInfo.Classes[className][call.Attr]; ok {
+				targets = append(targets, CallResolution{Module: moduleInfo.ModulePath, Class: className, Func: call.Attr})
+			}
+		}
+		if head, rest, ok := strings.Cut(call.Base, "."); ok {
+			if target, ok := moduleInfo.FromImports[head]; ok && getModuleInfo != nil {
+				if _, ok := moduleMap[target.Module]; ok {
+					if targetInfo, err := getModuleInfo(target.Module); err == nil && targetInfo != nil {
+						className := target.Name + "." + rest
+						if _, ok := targetInfo.Classes[className][call.Attr]; ok {
+							targets = append(targets, CallResolution{Module: target.Module, Class: className, Func: call.Attr})
+						}
+					}
+				}
+			}
+		}
+		return targets
+	}
+
+	if (call.Kind == "property_get" || call.Kind == "property_set") && call.Base != "" && call.Attr != "" {
+		if refs, ok := localTypes[call.Base]; ok {
+			for classRef := range refs {
+				targets = append(targets, resolvePropertyTargets(classRef, call.Attr, call.Kind, moduleMap, getModuleInfo)...)
 			}
 		}
+		if call.Base == "self" && currentClass != "" {
+			targets = append(targets, resolvePropertyTargets(ClassRef{Module: moduleInfo.ModulePath, Name: currentClass}, call.Attr, call.Kind, moduleMap, getModuleInfo)...)
+		}
 		return targets
 	}
 
 	if call.Kind == "ctor" && call.Base != "" && call.Attr != "" {
-		if methods, ok := moduleInfo.Classes[call.Base]; ok {
-			if _, ok := methods[call.Attr]; ok {
-				return []CallResolution{{Module: moduleInfo.ModulePath, Class: call.Base, Func: call.Attr}}
+		if className, ok := resolveScopedClass(moduleInfo, currentScope, call.Base); ok {
+			if _, ok := moduleInfo.Classes[className][call.Attr]; ok {
+				return []CallResolution{{Module: moduleInfo.ModulePath, Class: className, Func: call.Attr}}
 			}
 		}
 		if target, ok := moduleInfo.FromImports[call.Base]; ok {
@@ -1020,6 +1580,11 @@ func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[s
 	}
 
 	if call.Kind == "ctor_attr" && call.Base != "" && call.Attr != "" && call.Name != "" {
+		if className, ok := resolveScopedClass(moduleInfo, currentScope, call.Base+"."+call.Attr); ok {
+			if _, ok := moduleInfo.Classes[className][call.Name]; ok {
+				return []CallResolution{{Module: moduleInfo.ModulePath, Class: className, Func: call.Name}}
+			}
+		}
 		if modulePath, ok := moduleInfo.ModuleImports[call.Base]; ok {
 			if classExists(modulePath, call.Attr, moduleInfo, moduleMap, getModuleInfo) {
 				return []CallResolution{{Module: modulePath, Class: call.Attr, Func: call.Name}}
@@ -1037,297 +1602,4724 @@ func resolveCallTargets(call CallTarget, moduleInfo *ModuleInfo, moduleMap map[s
 	return targets
 }
 
-func getEntrySeeds(moduleInfo *ModuleInfo, entryObject string, entryClass string, entryMethod string) [][3]string {
-	seeds := make([][3]string, 0)
-	if entryClass != "" {
-		if entryMethod != "" {
-			if methods, ok := moduleInfo.Classes[entryClass]; ok {
-				if _, ok := methods[entryMethod]; ok {
-					seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryClass, entryMethod})
-				}
-			}
-			return seeds
-		}
-		if methods, ok := moduleInfo.Classes[entryClass]; ok {
-			for method := range methods {
-				seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryClass, method})
-			}
-		}
-		return seeds
+type AccessMode uint8
+
+const (
+	AccessRead AccessMode = 1 << iota
+	AccessWrite
+)
+
+func (m AccessMode) String() string {
+	switch {
+	case m&AccessRead != 0 && m&AccessWrite != 0:
+		return "rw"
+	case m&AccessWrite != 0:
+		return "w"
+	case m&AccessRead != 0:
+		return "r"
 	}
+	return "s"
+}
 
-	if entryObject == "" {
-		for fn := range moduleInfo.Functions {
-			seeds = append(seeds, [3]string{moduleInfo.ModulePath, "", fn})
-		}
-		for className, methods := range moduleInfo.Classes {
-			for method := range methods {
-				seeds = append(seeds, [3]string{moduleInfo.ModulePath, className, method})
+var modelOperationModes = map[string]AccessMode{
+	"get":              AccessRead,
+	"filter":           AccessRead,
+	"exclude":          AccessRead,
+	"all":              AccessRead,
+	"exists":           AccessRead,
+	"count":            AccessRead,
+	"first":            AccessRead,
+	"last":             AccessRead,
+	"earliest":         AccessRead,
+	"latest":           AccessRead,
+	"values":           AccessRead,
+	"values_list":      AccessRead,
+	"aggregate":        AccessRead,
+	"annotate":         AccessRead,
+	"in_bulk":          AccessRead,
+	"iterator":         AccessRead,
+	"order_by":         AccessRead,
+	"select_related":   AccessRead,
+	"prefetch_related": AccessRead,
+	"only":             AccessRead,
+	"defer":            AccessRead,
+	"distinct":         AccessRead,
+	"raw":              AccessRead,
+	"dates":            AccessRead,
+	"datetimes":        AccessRead,
+	"contains":         AccessRead,
+	"refresh_from_db":  AccessRead,
+	"save":             AccessWrite,
+	"create":           AccessWrite,
+	"update":           AccessWrite,
+	"delete":           AccessWrite,
+	"bulk_create":      AccessWrite,
+	"bulk_update":      AccessWrite,
+	"get_or_create":    AccessRead | AccessWrite,
+	"update_or_create": AccessRead | AccessWrite,
+	"session.query":    AccessRead,
+	"session.get":      AccessRead,
+	"session.add":      AccessWrite,
+	"session.add_all":  AccessWrite,
+	"session.merge":    AccessWrite,
+	"session.delete":   AccessWrite,
+	"sa.select":        AccessRead,
+	"sa.insert":        AccessWrite,
+	"sa.update":        AccessWrite,
+	"sa.delete":        AccessWrite,
+}
+
+type modelOperation struct {
+	Model   ModelRef
+	Manager string
+	Op      string
+	Mode    AccessMode
+	Call    *sitter.Node
+}
+
+func resolveModelName(text string, moduleInfo *ModuleInfo, moduleImports map[string]string, fromImports map[string]ImportFromTarget, moduleMap map[string]string) (ModelRef, bool) {
+	if text == "" {
+		return ModelRef{}, false
+	}
+	idx := strings.LastIndex(text, ".")
+	if idx < 0 {
+		if target, ok := fromImports[text]; ok {
+			if isModelClass(moduleInfo.IsSQLAlchemyModel, target.Module, target.Name) {
+				return ModelRef{Module: target.Module, Name: target.Name}, true
 			}
+			return ModelRef{}, false
 		}
-		return seeds
+		if _, ok := moduleInfo.Classes[text]; ok && isModelClass(moduleInfo.IsSQLAlchemyModel, moduleInfo.ModulePath, text) {
+			return ModelRef{Module: moduleInfo.ModulePath, Name: text}, true
+		}
+		return ModelRef{}, false
 	}
-
-	if _, ok := moduleInfo.Functions[entryObject]; ok {
-		seeds = append(seeds, [3]string{moduleInfo.ModulePath, "", entryObject})
-		return seeds
+	base := text[:idx]
+	attr := text[idx+1:]
+	if modulePath, ok := moduleImports[base]; ok {
+		if isModelClass(moduleInfo.IsSQLAlchemyModel, modulePath, attr) {
+			return ModelRef{Module: modulePath, Name: attr}, true
+		}
+		return ModelRef{}, false
 	}
-	if methods, ok := moduleInfo.Classes[entryObject]; ok {
-		for method := range methods {
-			seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryObject, method})
+	if target, ok := fromImports[base]; ok {
+		modulePath := target.Module + "." + target.Name
+		if _, ok := moduleMap[modulePath]; ok && isModelClass(moduleInfo.IsSQLAlchemyModel, modulePath, attr) {
+			return ModelRef{Module: modulePath, Name: attr}, true
 		}
-		return seeds
 	}
-	return seeds
+	return ModelRef{}, false
 }
 
-func collectModelsForEntrypoint(entrypoint string, srcRoot string) (map[ModelRef]struct{}, map[ModelRef]map[string]struct{}, map[ModelRef]bool, []string) {
-	moduleMap, mapErrors := buildModuleMapForRoots(srcRoot)
-	if len(mapErrors) > 0 {
-		return map[ModelRef]struct{}{}, map[ModelRef]map[string]struct{}{}, map[ModelRef]bool{}, mapErrors
-	}
-	pathToModule := buildPathToModuleMap(moduleMap)
-	moduleSpec := entrypoint
-	entryObject := ""
-	if strings.Contains(entrypoint, ":") {
-		parts := strings.SplitN(entrypoint, ":", 2)
-		moduleSpec = parts[0]
-		entryObject = parts[1]
-	}
-	modulePath := moduleSpec
-	if resolved, ok := resolveEntrypointModule(moduleSpec, srcRoot, moduleMap, pathToModule); ok {
-		modulePath = resolved
-	}
-	if _, ok := moduleMap[modulePath]; !ok {
-		return map[ModelRef]struct{}{}, map[ModelRef]map[string]struct{}{}, map[ModelRef]bool{}, []string{fmt.Sprintf("Module not found: %s", moduleSpec)}
-	}
-	entryClass := ""
-	entryMethod := ""
-	if entryObject != "" && strings.Contains(entryObject, "::") {
-		parts := strings.SplitN(entryObject, "::", 2)
-		entryClass = parts[0]
-		entryMethod = parts[1]
-		entryObject = ""
+func sameModel(a ModelRef, b ModelRef, getModuleInfo func(string) (*ModuleInfo, error)) bool {
+	if a == b {
+		return true
 	}
+	return a.Name == b.Name && definingModel(a, getModuleInfo) == definingModel(b, getModuleInfo)
+}
 
-	moduleCache := map[string]*ModuleInfo{}
-	getModuleInfo := func(path string) (*ModuleInfo, error) {
-		if info, ok := moduleCache[path]; ok {
-			return info, nil
+func definingModel(model ModelRef, getModuleInfo func(string) (*ModuleInfo, error)) ModelRef {
+	for depth := 0; depth < 8; depth++ {
+		info, err := getModuleInfo(model.Module)
+		if err != nil || info == nil {
+			break
 		}
-		info, err := parseModule(path, moduleMap[path])
-		if err != nil {
-			return nil, err
+		if _, ok := info.Classes[model.Name]; ok {
+			break
 		}
-		moduleCache[path] = info
-		return info, nil
+		target, ok := info.FromImports[model.Name]
+		if !ok {
+			break
+		}
+		model = ModelRef{Module: target.Module, Name: target.Name}
 	}
+	return model
+}
 
-	entryModule, err := getModuleInfo(modulePath)
-	if err != nil {
-		return map[ModelRef]struct{}{}, map[ModelRef]map[string]struct{}{}, map[ModelRef]bool{}, []string{err.Error()}
-	}
-	seeds := getEntrySeeds(entryModule, entryObject, entryClass, entryMethod)
-	if len(seeds) == 0 {
-		entryLabel := entryObject
-		if entryClass != "" {
-			if entryMethod != "" {
-				entryLabel = entryClass + "::" + entryMethod
-			} else {
-				entryLabel = entryClass
+func attributeChain(node *sitter.Node, source []byte) []string {
+	segments := []string{}
+	for node != nil {
+		switch node.Type() {
+		case "call":
+			node = node.ChildByFieldName("function")
+		case "attribute":
+			segments = append(segments, nodeText(source, node.ChildByFieldName("attribute")))
+			node = node.ChildByFieldName("object")
+		case "identifier":
+			segments = append(segments, nodeText(source, node))
+			for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+				segments[i], segments[j] = segments[j], segments[i]
 			}
+			return segments
+		default:
+			return nil
 		}
-		if entryLabel == "" {
-			entryLabel = "(module)"
-		}
-		return map[ModelRef]struct{}{}, map[ModelRef]map[string]struct{}{}, map[ModelRef]bool{}, []string{fmt.Sprintf("Entrypoint object not found: %s in %s", entryLabel, modulePath)}
 	}
+	return nil
+}
 
-	models := map[ModelRef]struct{}{}
-	modelUsage := map[ModelRef]map[string]struct{}{}
-	errors := []string{}
-	queue := make([][3]string, 0, len(seeds))
-	queue = append(queue, seeds...)
-	visited := map[[3]string]struct{}{}
-
-	for len(queue) > 0 {
-		current := queue[0]
-		queue = queue[1:]
-		moduleName := current[0]
-		className := current[1]
-		funcName := current[2]
-		if funcName == "" {
-			continue
-		}
-		key := [3]string{moduleName, className, funcName}
-		if _, ok := visited[key]; ok {
-			continue
+func collectModelOperations(functionNode *sitter.Node, moduleInfo *ModuleInfo, moduleMap map[string]string, localTypes map[string]map[ClassRef]struct{}) []modelOperation {
+	moduleImports, fromImports := collectScopedImports(functionNode, moduleInfo)
+	ops := []modelOperation{}
+	sessions := collectSessionNames(functionNode, moduleInfo.Source)
+	walkScope(functionNode, func(n *sitter.Node) {
+		if n.Type() != "call" {
+			return
 		}
-		visited[key] = struct{}{}
-
-		if _, ok := moduleMap[moduleName]; !ok {
-			continue
+		fnNode := n.ChildByFieldName("function")
+		if statementOp, ok := sqlAlchemyStatementOp(fnNode, moduleInfo.Source, moduleImports, fromImports); ok {
+			for _, arg := range positionalArguments(n.ChildByFieldName("arguments")) {
+				if model, ok := resolveInstanceOrModel(arg, moduleInfo, moduleImports, fromImports, moduleMap, localTypes); ok {
+					ops = append(ops, modelOperation{Model: model, Op: statementOp, Mode: modelOperationModes[statementOp], Call: n})
+				}
+			}
+			return
 		}
-		moduleInfo, err := getModuleInfo(moduleName)
-		if err != nil {
-			errors = append(errors, err.Error())
-			continue
+		if fnNode == nil || fnNode.Type() != "attribute" {
+			return
 		}
-		var funcNode *sitter.Node
-		if className != "" {
-			if methods, ok := moduleInfo.Classes[className]; ok {
-				funcNode = methods[funcName]
-			}
-		} else {
-			funcNode = moduleInfo.Functions[funcName]
+		attr := fnNode.ChildByFieldName("attribute")
+		if attr == nil || attr.Type() != "identifier" {
+			return
 		}
-		if funcNode == nil {
-			errors = append(errors, fmt.Sprintf("Function not found: %s:%s.%s", moduleName, className, funcName))
-			continue
+		op := nodeText(moduleInfo.Source, attr)
+		chain := attributeChain(fnNode.ChildByFieldName("object"), moduleInfo.Source)
+		if len(chain) == 0 {
+			return
 		}
-
-		foundModels := analyzeFunctionModels(funcNode, moduleInfo, moduleMap)
-		usageKey := fmt.Sprintf("%s:%s%s", moduleInfo.ModulePath, funcClassPrefix(className), funcName)
-		for model := range foundModels {
-			models[model] = struct{}{}
-			if _, ok := modelUsage[model]; !ok {
-				modelUsage[model] = map[string]struct{}{}
+		terminal := isTerminalCall(n)
+		add := func(model ModelRef, manager string, op string) {
+			mode := AccessMode(0)
+			if terminal {
+				var ok bool
+				if mode, ok = modelOperationModes[op]; !ok && manager != "" {
+					mode = AccessRead
+				}
 			}
-			modelUsage[model][usageKey] = struct{}{}
+			ops = append(ops, modelOperation{Model: model, Manager: manager, Op: op, Mode: mode, Call: n})
 		}
-
-		localTypes := collectLocalVariableTypes(funcNode, moduleInfo, moduleMap, getModuleInfo)
-		for _, call := range analyzeFunctionCalls(funcNode, moduleInfo.Source) {
-			targets := resolveCallTargets(call, moduleInfo, moduleMap, className, getModuleInfo, localTypes)
-			for _, target := range targets {
-				if target.Func == "" {
-					continue
+		if isSessionReceiver(chain, sessions) {
+			sessionOp := "session." + op
+			if _, ok := modelOperationModes[sessionOp]; !ok {
+				return
+			}
+			for _, arg := range sessionModelArguments(n.ChildByFieldName("arguments")) {
+				if model, ok := resolveInstanceOrModel(arg, moduleInfo, moduleImports, fromImports, moduleMap, localTypes); ok {
+					ops = append(ops, modelOperation{Model: model, Op: sessionOp, Mode: modelOperationModes[sessionOp], Call: n})
 				}
-				if _, ok := moduleMap[target.Module]; ok {
-					queue = append(queue, [3]string{target.Module, target.Class, target.Func})
+			}
+			return
+		}
+		if refs, ok := localTypes[strings.Join(chain, ".")]; ok {
+			for classRef := range refs {
+				if isModelClass(moduleInfo.IsSQLAlchemyModel, classRef.Module, classRef.Name) {
+					add(ModelRef{Module: classRef.Module, Name: classRef.Name}, "", op)
 				}
 			}
+			return
 		}
-	}
+		if model, ok := resolveModelName(chain[0], moduleInfo, moduleImports, fromImports, moduleMap); ok {
+			add(model, chainSegment(chain, 1), op)
+			return
+		}
+		if len(chain) >= 2 {
+			if model, ok := resolveModelName(chain[0]+"."+chain[1], moduleInfo, moduleImports, fromImports, moduleMap); ok {
+				add(model, chainSegment(chain, 2), op)
+			}
+		}
+	})
+	return ops
+}
 
-	modelBaseInfo := map[ModelRef]bool{}
-	for model := range models {
-		bases := resolveModelBases(model, moduleMap, getModuleInfo, map[ModelRef]struct{}{})
-		if isNetworkModelBase(bases) {
-			modelBaseInfo[model] = true
+func sqlAlchemyStatementOp(fnNode *sitter.Node, source []byte, moduleImports map[string]string, fromImports map[string]ImportFromTarget) (string, bool) {
+	if fnNode == nil {
+		return "", false
+	}
+	isSQLAlchemy := func(modulePath string) bool {
+		return modulePath == "sqlalchemy" || strings.HasPrefix(modulePath, "sqlalchemy.")
+	}
+	name := ""
+	switch fnNode.Type() {
+	case "identifier":
+		target, ok := fromImports[nodeText(source, fnNode)]
+		if !ok || !isSQLAlchemy(target.Module) {
+			return "", false
+		}
+		name = target.Name
+	case "attribute":
+		obj := fnNode.ChildByFieldName("object")
+		if obj == nil || obj.Type() != "identifier" || !isSQLAlchemy(moduleImports[nodeText(source, obj)]) {
+			return "", false
 		}
+		name = nodeText(source, fnNode.ChildByFieldName("attribute"))
+	default:
+		return "", false
+	}
+	switch name {
+	case "select", "insert", "update", "delete":
+		return "sa." + name, true
 	}
+	return "", false
+}
 
-	return models, modelUsage, modelBaseInfo, errors
+func isTerminalCall(callNode *sitter.Node) bool {
+	parent := callNode.Parent()
+	if parent == nil || parent.Type() != "attribute" || fieldName(parent, callNode) != "object" {
+		return true
+	}
+	grandparent := parent.Parent()
+	return grandparent == nil || grandparent.Type() != "call" || fieldName(grandparent, parent) != "function"
 }
 
-func funcClassPrefix(className string) string {
-	if className == "" {
-		return ""
+func isSessionReceiver(chain []string, sessions map[string]struct{}) bool {
+	if _, ok := sessions[strings.Join(chain, ".")]; ok {
+		return true
 	}
-	return className + "."
+	last := strings.ToLower(chain[len(chain)-1])
+	return last == "session" || last == "db" || strings.HasSuffix(last, "_session") || strings.HasPrefix(last, "session_")
 }
 
-func nodeText(source []byte, node *sitter.Node) string {
-	if node == nil {
-		return ""
+func isSessionType(node *sitter.Node, source []byte) bool {
+	found := false
+	walk(node, func(n *sitter.Node) {
+		if n.Type() == "identifier" && strings.HasSuffix(nodeText(source, n), "Session") {
+			found = true
+		}
+	})
+	return found
+}
+
+func collectSessionNames(functionNode *sitter.Node, source []byte) map[string]struct{} {
+	sessions := map[string]struct{}{}
+	bind := func(name *sitter.Node, value *sitter.Node) {
+		if name == nil || value == nil || name.Type() != "identifier" {
+			return
+		}
+		if value.Type() == "await" && value.NamedChildCount() > 0 {
+			value = value.NamedChild(0)
+		}
+		if value.Type() == "call" && isSessionType(value.ChildByFieldName("function"), source) {
+			sessions[nodeText(source, name)] = struct{}{}
+		}
 	}
-	return string(source[node.StartByte():node.EndByte()])
+	if params := functionNode.ChildByFieldName("parameters"); params != nil {
+		for i := 0; i < int(params.NamedChildCount()); i++ {
+			param := params.NamedChild(i)
+			name := param.ChildByFieldName("name")
+			switch param.Type() {
+			case "typed_parameter":
+				name = param.NamedChild(0)
+			case "typed_default_parameter":
+			default:
+				continue
+			}
+			if name != nil && name.Type() == "identifier" && isSessionType(param.ChildByFieldName("type"), source) {
+				sessions[nodeText(source, name)] = struct{}{}
+			}
+		}
+	}
+	walkScope(functionNode, func(n *sitter.Node) {
+		switch n.Type() {
+		case "assignment":
+			bind(n.ChildByFieldName("left"), n.ChildByFieldName("right"))
+		case "as_pattern":
+			if alias := n.ChildByFieldName("alias"); alias != nil && n.NamedChildCount() > 0 {
+				if alias.Type() != "identifier" && alias.NamedChildCount() > 0 {
+					alias = alias.NamedChild(0)
+				}
+				bind(alias, n.NamedChild(0))
+			}
+		}
+	})
+	return sessions
 }
 
-func fieldName(parent *sitter.Node, child *sitter.Node) string {
-	if parent == nil || child == nil {
-		return ""
+func sessionModelArguments(args *sitter.Node) []*sitter.Node {
+	positional := positionalArguments(args)
+	if len(positional) == 0 {
+		return nil
 	}
-	for i := 0; i < int(parent.ChildCount()); i++ {
-		if parent.Child(i).ID() == child.ID() {
-			return parent.FieldNameForChild(i)
+	first := positional[0]
+	switch first.Type() {
+	case "list", "tuple":
+		items := []*sitter.Node{}
+		for i := 0; i < int(first.NamedChildCount()); i++ {
+			items = append(items, first.NamedChild(i))
 		}
+		return items
 	}
-	return ""
+	return []*sitter.Node{first}
 }
 
-func walk(node *sitter.Node, fn func(*sitter.Node)) {
+func resolveInstanceOrModel(node *sitter.Node, moduleInfo *ModuleInfo, moduleImports map[string]string, fromImports map[string]ImportFromTarget, moduleMap map[string]string, localTypes map[string]map[ClassRef]struct{}) (ModelRef, bool) {
 	if node == nil {
-		return
+		return ModelRef{}, false
 	}
-	fn(node)
-	for i := 0; i < int(node.ChildCount()); i++ {
-		child := node.Child(i)
-		walk(child, fn)
+	if callNode := unwrapCallNode(node); callNode != nil {
+		node = callNode.ChildByFieldName("function")
+	}
+	if node == nil {
+		return ModelRef{}, false
+	}
+	text := nodeText(moduleInfo.Source, node)
+	if refs, ok := localTypes[text]; ok {
+		for classRef := range refs {
+			if isModelClass(moduleInfo.IsSQLAlchemyModel, classRef.Module, classRef.Name) {
+				return ModelRef{Module: classRef.Module, Name: classRef.Name}, true
+			}
+		}
 	}
+	if model, ok := resolveModelName(text, moduleInfo, moduleImports, fromImports, moduleMap); ok {
+		return model, true
+	}
+	if node.Type() == "attribute" {
+		return resolveModelName(nodeText(moduleInfo.Source, node.ChildByFieldName("object")), moduleInfo, moduleImports, fromImports, moduleMap)
+	}
+	return ModelRef{}, false
 }
 
-func main() {
-	entrypoint := flag.String("entrypoint", "", "Entrypoint like 'pkg.module:MyClass' or 'src/path/file.py:MyClass::method'")
-	rootFlag := flag.String("root", "", "Python source root (base directory containing package roots).")
-	explain := flag.Bool("explain", false, "Print where each model is used (module:function).")
-	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "modex traces a Python entrypoint and lists referenced models from static analysis.")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Usage:")
-		fmt.Fprintln(os.Stderr, "  modex --entrypoint <module-or-path[:object]> [--root <path>] [--explain]")
-		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "Flags:")
-		flag.PrintDefaults()
+func chainSegment(chain []string, index int) string {
+	if index < len(chain) {
+		return chain[index]
 	}
-	flag.Parse()
+	return ""
+}
 
-	if flag.NArg() == 0 && *entrypoint == "" {
-		flag.Usage()
-		return
-	}
+type classDefinition struct {
+	Info *ModuleInfo
+	Name string
+}
 
-	if *entrypoint == "" {
-		fmt.Fprintln(os.Stderr, "ERROR: --entrypoint is required")
-		os.Exit(2)
+func resolveClassDefinition(ref ClassRef, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (classDefinition, bool) {
+	if depth > 8 || ref.Module == "" || ref.Name == "" || getModuleInfo == nil {
+		return classDefinition{}, false
 	}
-
-	root := *rootFlag
-	if root == "" {
-		root = getRoot()
+	if _, ok := moduleMap[ref.Module]; !ok {
+		return classDefinition{}, false
 	}
-	models, modelUsage, modelBaseInfo, errors := collectModelsForEntrypoint(*entrypoint, root)
-	if len(errors) > 0 {
-		for _, err := range errors {
-			fmt.Printf("ERROR: %s\n", err)
-		}
-		os.Exit(2)
+	info, err := getModuleInfo(ref.Module)
+	if err != nil || info == nil {
+		return classDefinition{}, false
+	}
+	if _, ok := info.Classes[ref.Name]; ok {
+		return classDefinition{Info: info, Name: ref.Name}, true
+	}
+	if target, ok := info.FromImports[ref.Name]; ok {
+		return resolveClassDefinition(ClassRef{Module: target.Module, Name: target.Name}, moduleMap, getModuleInfo, depth+1)
 	}
+	return classDefinition{}, false
+}
 
-	modelList := make([]ModelRef, 0, len(models))
-	for model := range models {
-		modelList = append(modelList, model)
+func resolveClassReference(text string, info *ModuleInfo, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (classDefinition, bool) {
+	if _, ok := info.Classes[text]; ok {
+		return classDefinition{Info: info, Name: text}, true
 	}
-	sort.Slice(modelList, func(i, j int) bool {
-		if modelList[i].Module == modelList[j].Module {
-			return modelList[i].Name < modelList[j].Name
+	if target, ok := info.FromImports[text]; ok {
+		return resolveClassDefinition(ClassRef{Module: target.Module, Name: target.Name}, moduleMap, getModuleInfo, 0)
+	}
+	if idx := strings.LastIndex(text, "."); idx > 0 {
+		if modulePath, ok := info.ModuleImports[text[:idx]]; ok {
+			return resolveClassDefinition(ClassRef{Module: modulePath, Name: text[idx+1:]}, moduleMap, getModuleInfo, 0)
 		}
-		return modelList[i].Module < modelList[j].Module
-	})
+		if target, ok := info.FromImports[text[:idx]]; ok {
+			return resolveClassDefinition(ClassRef{Module: target.Module + "." + target.Name, Name: text[idx+1:]}, moduleMap, getModuleInfo, 0)
+		}
+	}
+	return classDefinition{}, false
+}
+
+func resolveManagerClasses(model classDefinition, attr string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) []classDefinition {
+	if depth > 8 {
+		return nil
+	}
+	value, ok := model.Info.ClassAttrs[model.Name][attr]
+	if !ok {
+		for _, base := range model.Info.ClassBases[model.Name] {
+			if parent, ok := resolveClassReference(base, model.Info, moduleMap, getModuleInfo); ok {
+				if managers := resolveManagerClasses(parent, attr, moduleMap, getModuleInfo, depth+1); len(managers) > 0 {
+					return managers
+				}
+			}
+		}
+		return nil
+	}
+	callNode := unwrapCallNode(value)
+	if callNode == nil {
+		return nil
+	}
+	managers := []classDefinition{}
+	fnNode := callNode.ChildByFieldName("function")
+	if inner := unwrapCallNode(fnNode); inner != nil {
+		innerFn := inner.ChildByFieldName("function")
+		if innerFn != nil && innerFn.Type() == "attribute" && nodeText(model.Info.Source, innerFn.ChildByFieldName("attribute")) == "from_queryset" {
+			if manager, ok := resolveClassReference(nodeText(model.Info.Source, innerFn.ChildByFieldName("object")), model.Info, moduleMap, getModuleInfo); ok {
+				managers = append(managers, manager)
+			}
+			for _, arg := range positionalArguments(inner.ChildByFieldName("arguments")) {
+				if queryset, ok := resolveClassReference(nodeText(model.Info.Source, arg), model.Info, moduleMap, getModuleInfo); ok {
+					managers = append(managers, queryset)
+				}
+			}
+		}
+		return managers
+	}
+	text := nodeText(model.Info.Source, fnNode)
+	text = strings.TrimSuffix(text, ".as_manager")
+	if manager, ok := resolveClassReference(text, model.Info, moduleMap, getModuleInfo); ok {
+		managers = append(managers, manager)
+	}
+	return managers
+}
+
+func resolveModelOperationTargets(op modelOperation, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []CallResolution {
+	model, ok := resolveClassDefinition(ClassRef{Module: op.Model.Module, Name: op.Model.Name}, moduleMap, getModuleInfo, 0)
+	if !ok {
+		return nil
+	}
+	if op.Manager == "" {
+		if _, ok := model.Info.Classes[model.Name][op.Op]; ok {
+			return []CallResolution{{Module: model.Info.ModulePath, Class: model.Name, Func: op.Op}}
+		}
+		return nil
+	}
+	targets := []CallResolution{}
+	for _, manager := range resolveManagerClasses(model, op.Manager, moduleMap, getModuleInfo, 0) {
+		if _, ok := manager.Info.Classes[manager.Name][op.Op]; ok {
+			targets = append(targets, CallResolution{Module: manager.Info.ModulePath, Class: manager.Name, Func: op.Op})
+		}
+	}
+	return targets
+}
+
+func modelFieldType(value *sitter.Node, source []byte) (string, bool) {
+	callNode := unwrapCallNode(value)
+	if callNode == nil {
+		return "", false
+	}
+	name := nodeText(source, callNode.ChildByFieldName("function"))
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	switch {
+	case strings.HasSuffix(name, "Field"), strings.HasSuffix(name, "ForeignKey"):
+		return name, true
+	case name == "Column", name == "mapped_column", name == "relationship":
+		return name, true
+	}
+	return "", false
+}
+
+func collectModelFields(model classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) map[string]string {
+	fields := map[string]string{}
+	if depth > 8 {
+		return fields
+	}
+	for _, base := range model.Info.ClassBases[model.Name] {
+		if parent, ok := resolveClassReference(base, model.Info, moduleMap, getModuleInfo); ok {
+			for name, fieldType := range collectModelFields(parent, moduleMap, getModuleInfo, depth+1) {
+				fields[name] = fieldType
+			}
+		}
+	}
+	for name, value := range model.Info.ClassAttrs[model.Name] {
+		if fieldType, ok := modelFieldType(value, model.Info.Source); ok {
+			fields[name] = fieldType
+		}
+	}
+	return fields
+}
+
+var fieldKeywordOps = map[string]struct{}{
+	"filter":           {},
+	"exclude":          {},
+	"get":              {},
+	"update":           {},
+	"create":           {},
+	"get_or_create":    {},
+	"update_or_create": {},
+}
+
+var fieldStringOps = map[string]struct{}{
+	"values":           {},
+	"values_list":      {},
+	"only":             {},
+	"defer":            {},
+	"order_by":         {},
+	"select_related":   {},
+	"prefetch_related": {},
+	"distinct":         {},
+}
+
+func lookupFieldName(lookup string) string {
+	lookup = strings.TrimPrefix(strings.TrimSpace(lookup), "-")
+	if idx := strings.Index(lookup, "__"); idx >= 0 {
+		lookup = lookup[:idx]
+	}
+	return lookup
+}
+
+func operationFieldNames(op modelOperation, source []byte) []string {
+	if op.Call == nil {
+		return nil
+	}
+	args := op.Call.ChildByFieldName("arguments")
+	if args == nil {
+		return nil
+	}
+	names := []string{}
+	if _, ok := fieldKeywordOps[op.Op]; ok {
+		walk(args, func(n *sitter.Node) {
+			if n.Type() != "keyword_argument" {
+				return
+			}
+			owner := n.Parent()
+			if owner != nil {
+				owner = owner.Parent()
+			}
+			if owner == nil || owner.Type() != "call" {
+				return
+			}
+			if owner != op.Call {
+				callee := nodeText(source, owner.ChildByFieldName("function"))
+				if callee != "Q" && !strings.HasSuffix(callee, ".Q") {
+					return
+				}
+			}
+			name := nodeText(source, n.ChildByFieldName("name"))
+			if name == "defaults" || name == "create_defaults" {
+				names = append(names, dictionaryStringKeys(n.ChildByFieldName("value"), source)...)
+				return
+			}
+			names = append(names, lookupFieldName(name))
+		})
+	}
+	if _, ok := fieldStringOps[op.Op]; ok {
+		for _, arg := range positionalArguments(args) {
+			if value, ok := stringLiteralValue(arg, source); ok {
+				names = append(names, lookupFieldName(value))
+			}
+		}
+	}
+	if op.Op == "save" {
+		if value := keywordArgument(args, "update_fields", source); value != nil {
+			for i := 0; i < int(value.NamedChildCount()); i++ {
+				if item, ok := stringLiteralValue(value.NamedChild(i), source); ok {
+					names = append(names, item)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func dictionaryStringKeys(node *sitter.Node, source []byte) []string {
+	if node == nil || node.Type() != "dictionary" {
+		return nil
+	}
+	keys := []string{}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		pair := node.NamedChild(i)
+		if pair == nil || pair.Type() != "pair" {
+			continue
+		}
+		if key, ok := stringLiteralValue(pair.ChildByFieldName("key"), source); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func stringLiteralValue(node *sitter.Node, source []byte) (string, bool) {
+	if node == nil || node.Type() != "string" {
+		return "", false
+	}
+	text := nodeText(source, node)
+	prefixEnd := strings.IndexAny(text, "'\"")
+	if prefixEnd < 0 || strings.ContainsAny(strings.ToLower(text[:prefixEnd]), "f") {
+		return "", false
+	}
+	quote := text[prefixEnd:]
+	for _, delim := range []string{`"""`, "'''", `"`, "'"} {
+		if strings.HasPrefix(quote, delim) && strings.HasSuffix(quote, delim) && len(quote) >= 2*len(delim) {
+			return quote[len(delim) : len(quote)-len(delim)], true
+		}
+	}
+	return "", false
+}
+
+func collectInstanceFieldReads(functionNode *sitter.Node, source []byte, localTypes map[string]map[ClassRef]struct{}, isSQLAlchemyModel func(ModelRef) bool) map[ModelRef][]string {
+	reads := map[ModelRef][]string{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "attribute" {
+			return
+		}
+		obj := n.ChildByFieldName("object")
+		attr := n.ChildByFieldName("attribute")
+		if obj == nil || attr == nil || attr.Type() != "identifier" {
+			return
+		}
+		parent := n.Parent()
+		if parent != nil && parent.Type() == "call" && fieldName(parent, n) == "function" {
+			return
+		}
+		if isAssignmentTarget(n) {
+			return
+		}
+		refs, ok := localTypes[nodeText(source, obj)]
+		if !ok {
+			return
+		}
+		for classRef := range refs {
+			if isModelClass(isSQLAlchemyModel, classRef.Module, classRef.Name) {
+				model := ModelRef{Module: classRef.Module, Name: classRef.Name}
+				reads[model] = append(reads[model], nodeText(source, attr))
+			}
+		}
+	})
+	return reads
+}
+
+func isAssignmentTarget(node *sitter.Node) bool {
+	for parent := node.Parent(); parent != nil; node, parent = parent, parent.Parent() {
+		switch parent.Type() {
+		case "pattern_list", "tuple_pattern", "list_pattern", "tuple", "list":
+			continue
+		case "assignment":
+			return fieldName(parent, node) == "left"
+		}
+		return false
+	}
+	return false
+}
+
+// modelLifecycleMethods are invoked by Django implicitly, so overrides are followed.
+var modelLifecycleMethods = map[string][]string{
+	"save":             {"save"},
+	"create":           {"save"},
+	"get_or_create":    {"save"},
+	"update_or_create": {"save"},
+	"delete":           {"delete"},
+	"full_clean":       {"full_clean", "clean_fields", "clean", "validate_unique"},
+}
+
+func resolveLifecycleTargets(op modelOperation, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []CallResolution {
+	methods, ok := modelLifecycleMethods[op.Op]
+	if !ok {
+		return nil
+	}
+	// QuerySet.delete() deletes in bulk without calling Model.delete().
+	if op.Op == "delete" && op.Manager != "" {
+		return nil
+	}
+	model, ok := resolveClassDefinition(ClassRef{Module: op.Model.Module, Name: op.Model.Name}, moduleMap, getModuleInfo, 0)
+	if !ok {
+		return nil
+	}
+	return collectMethodOverrides(model, methods, moduleMap, getModuleInfo, 0)
+}
+
+func collectMethodOverrides(class classDefinition, methods []string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) []CallResolution {
+	if depth > 8 {
+		return nil
+	}
+	targets := []CallResolution{}
+	for _, method := range methods {
+		if _, ok := class.Info.Classes[class.Name][method]; ok {
+			targets = append(targets, CallResolution{Module: class.Info.ModulePath, Class: class.Name, Func: method})
+		}
+	}
+	for _, base := range class.Info.ClassBases[class.Name] {
+		if parent, ok := resolveClassReference(base, class.Info, moduleMap, getModuleInfo); ok {
+			targets = append(targets, collectMethodOverrides(parent, methods, moduleMap, getModuleInfo, depth+1)...)
+		}
+	}
+	return targets
+}
+
+var drfViewActions = map[string][]string{
+	"ModelViewSet":                 {"list", "retrieve", "create", "update", "partial_update", "destroy"},
+	"ReadOnlyModelViewSet":         {"list", "retrieve"},
+	"GenericViewSet":               {},
+	"ViewSet":                      {},
+	"ViewSetMixin":                 {},
+	"APIView":                      {},
+	"GenericAPIView":               {},
+	"ListModelMixin":               {"list"},
+	"RetrieveModelMixin":           {"retrieve"},
+	"CreateModelMixin":             {"create"},
+	"UpdateModelMixin":             {"update", "partial_update"},
+	"DestroyModelMixin":            {"destroy"},
+	"ListAPIView":                  {"list"},
+	"RetrieveAPIView":              {"retrieve"},
+	"CreateAPIView":                {"create"},
+	"UpdateAPIView":                {"update", "partial_update"},
+	"DestroyAPIView":               {"destroy"},
+	"ListCreateAPIView":            {"list", "create"},
+	"RetrieveUpdateAPIView":        {"retrieve", "update", "partial_update"},
+	"RetrieveDestroyAPIView":       {"retrieve", "destroy"},
+	"RetrieveUpdateDestroyAPIView": {"retrieve", "update", "partial_update", "destroy"},
+}
+
+var drfActionHooks = map[string][]string{
+	"list":           {"get_queryset", "filter_queryset", "paginate_queryset", "get_serializer_class", "get_serializer"},
+	"retrieve":       {"get_queryset", "filter_queryset", "get_object", "get_serializer_class", "get_serializer"},
+	"create":         {"get_serializer_class", "get_serializer", "perform_create"},
+	"update":         {"get_queryset", "filter_queryset", "get_object", "get_serializer_class", "get_serializer", "perform_update"},
+	"partial_update": {"get_queryset", "filter_queryset", "get_object", "get_serializer_class", "get_serializer", "perform_update"},
+	"destroy":        {"get_queryset", "filter_queryset", "get_object", "perform_destroy"},
+}
+
+func drfActions(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (map[string]struct{}, bool) {
+	if depth > 8 {
+		return nil, false
+	}
+	actions := map[string]struct{}{}
+	isView := false
+	for _, base := range def.Info.ClassBases[def.Name] {
+		if full := importedName(base, def.Info); strings.HasPrefix(full, "rest_framework.") {
+			if names, ok := drfViewActions[full[strings.LastIndex(full, ".")+1:]]; ok {
+				isView = true
+				for _, name := range names {
+					actions[name] = struct{}{}
+				}
+			}
+			continue
+		}
+		if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok && parent != def {
+			if names, ok := drfActions(parent, moduleMap, getModuleInfo, depth+1); ok {
+				isView = true
+				for name := range names {
+					actions[name] = struct{}{}
+				}
+			}
+		}
+	}
+	return actions, isView
+}
+
+func inheritedClassAttr(def classDefinition, attr string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (classDefinition, *sitter.Node, bool) {
+	if depth > 8 {
+		return classDefinition{}, nil, false
+	}
+	if value, ok := def.Info.ClassAttrs[def.Name][attr]; ok {
+		return def, value, true
+	}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok && parent != def {
+			if owner, value, ok := inheritedClassAttr(parent, attr, moduleMap, getModuleInfo, depth+1); ok {
+				return owner, value, true
+			}
+		}
+	}
+	return classDefinition{}, nil, false
+}
+
+func serializerModel(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (ModelRef, bool) {
+	if depth > 8 {
+		return ModelRef{}, false
+	}
+	if value, ok := def.Info.ClassAttrs[def.Name+".Meta"]["model"]; ok {
+		return resolveModelName(nodeText(def.Info.Source, value), def.Info, def.Info.ModuleImports, def.Info.FromImports, moduleMap)
+	}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok && parent != def {
+			if model, ok := serializerModel(parent, moduleMap, getModuleInfo, depth+1); ok {
+				return model, true
+			}
+		}
+	}
+	return ModelRef{}, false
+}
+
+func drfActionMethods(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) []CallResolution {
+	if depth > 8 {
+		return nil
+	}
+	targets := []CallResolution{}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo)
+		if !ok || parent == def {
+			continue
+		}
+		for method, nodes := range parent.Info.Classes[parent.Name] {
+			for _, node := range nodes {
+				for _, decorator := range functionDecorators(node, parent.Info.Source) {
+					if decorator == "action" || strings.HasPrefix(decorator, "action(") || strings.HasSuffix(strings.SplitN(decorator, "(", 2)[0], ".action") {
+						targets = append(targets, CallResolution{Module: parent.Info.ModulePath, Class: parent.Name, Func: method})
+					}
+				}
+			}
+		}
+		targets = append(targets, drfActionMethods(parent, moduleMap, getModuleInfo, depth+1)...)
+	}
+	return targets
+}
+
+type drfViewTrace struct {
+	Seeds  [][3]string
+	Usages map[ModelRef]map[string]AccessMode
+}
+
+func traceDRFView(def classDefinition, only string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (drfViewTrace, bool) {
+	actions, ok := drfActions(def, moduleMap, getModuleInfo, 0)
+	if !ok {
+		return drfViewTrace{}, false
+	}
+	trace := drfViewTrace{Usages: map[ModelRef]map[string]AccessMode{}}
+	seen := map[[3]string]struct{}{}
+	seed := func(targets []CallResolution) {
+		for _, target := range targets {
+			key := [3]string{target.Module, target.Class, target.Func}
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				trace.Seeds = append(trace.Seeds, key)
+			}
+		}
+	}
+	record := func(model ModelRef, action string, mode AccessMode) {
+		if _, ok := trace.Usages[model]; !ok {
+			trace.Usages[model] = map[string]AccessMode{}
+		}
+		trace.Usages[model][fmt.Sprintf("%s:%s.%s (implicit)", def.Info.ModulePath, def.Name, action)] |= mode
+	}
+	overrides := func(class classDefinition, method string) []CallResolution {
+		return collectMethodOverrides(class, []string{method}, moduleMap, getModuleInfo, 0)
+	}
+	eachBody := func(targets []CallResolution, fn func(*sitter.Node, *ModuleInfo)) {
+		for _, target := range targets {
+			info, err := getModuleInfo(target.Module)
+			if err != nil || info == nil {
+				continue
+			}
+			for _, node := range info.Classes[target.Class][target.Func] {
+				fn(node, info)
+			}
+		}
+	}
+
+	querysetModels := map[ModelRef]struct{}{}
+	if owner, value, ok := inheritedClassAttr(def, "queryset", moduleMap, getModuleInfo, 0); ok {
+		querysetModels = analyzeFunctionModels(value, owner.Info, moduleMap)
+	} else {
+		eachBody(overrides(def, "get_queryset"), func(node *sitter.Node, info *ModuleInfo) {
+			for model := range analyzeFunctionModels(node, info, moduleMap) {
+				querysetModels[model] = struct{}{}
+			}
+		})
+	}
+	serializers := []classDefinition{}
+	if owner, value, ok := inheritedClassAttr(def, "serializer_class", moduleMap, getModuleInfo, 0); ok {
+		if serializer, ok := resolveClassReference(nodeText(owner.Info.Source, value), owner.Info, moduleMap, getModuleInfo); ok {
+			serializers = append(serializers, serializer)
+		}
+	}
+	eachBody(overrides(def, "get_serializer_class"), func(node *sitter.Node, info *ModuleInfo) {
+		for _, ref := range collectClassReferences(node, info, moduleMap, getModuleInfo) {
+			if _, ok := serializerModel(ref, moduleMap, getModuleInfo, 0); ok {
+				serializers = append(serializers, ref)
+			}
+		}
+	})
+
+	actionList := make([]string, 0, len(actions))
+	for action := range actions {
+		actionList = append(actionList, action)
+	}
+	sort.Strings(actionList)
+	for _, action := range actionList {
+		if only != "" && action != only {
+			continue
+		}
+		if targets := overrides(def, action); len(targets) > 0 {
+			seed(targets)
+			continue
+		}
+		for _, hook := range drfActionHooks[action] {
+			seed(overrides(def, hook))
+		}
+		if action != "create" {
+			for model := range querysetModels {
+				record(model, action, AccessRead)
+			}
+		}
+		switch action {
+		case "list", "retrieve":
+			for _, serializer := range serializers {
+				if model, ok := serializerModel(serializer, moduleMap, getModuleInfo, 0); ok {
+					record(model, action, AccessRead)
+				}
+			}
+		case "create", "update", "partial_update":
+			method := "create"
+			if action != "create" {
+				method = "update"
+			}
+			for _, serializer := range serializers {
+				if targets := overrides(serializer, method); len(targets) > 0 {
+					seed(targets)
+				} else if model, ok := serializerModel(serializer, moduleMap, getModuleInfo, 0); ok {
+					record(model, action, AccessWrite)
+				}
+			}
+		case "destroy":
+			if len(overrides(def, "perform_destroy")) == 0 {
+				for model := range querysetModels {
+					record(model, action, AccessWrite)
+				}
+			}
+		}
+	}
+	if only == "" {
+		seed(drfActionMethods(def, moduleMap, getModuleInfo, 0))
+	}
+	return trace, true
+}
+
+type SignalReceiver struct {
+	Signal string
+	Sender ModelRef
+	Target CallResolution
+}
+
+var modelSignalOps = map[string][]string{
+	"save":             {"pre_save", "post_save"},
+	"create":           {"pre_save", "post_save"},
+	"get_or_create":    {"pre_save", "post_save"},
+	"update_or_create": {"pre_save", "post_save"},
+	"delete":           {"pre_delete", "post_delete"},
+}
+
+func buildSignalRegistry(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []SignalReceiver {
+	modulePaths := make([]string, 0, len(moduleMap))
+	for modulePath := range moduleMap {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	modelsByName := map[string][]ModelRef{}
+	for _, modulePath := range modulePaths {
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil {
+			continue
+		}
+		for className := range info.Classes {
+			if isModelClass(info.IsSQLAlchemyModel, modulePath, className) {
+				modelsByName[className] = append(modelsByName[className], ModelRef{Module: modulePath, Name: className})
+			}
+		}
+	}
+
+	receivers := []SignalReceiver{}
+	for _, modulePath := range modulePaths {
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil {
+			continue
+		}
+		functionNames := map[uintptr]string{}
+		for name, nodes := range info.Functions {
+			for _, node := range nodes {
+				functionNames[node.ID()] = name
+			}
+		}
+		register := func(signals []string, args *sitter.Node, target CallResolution) {
+			senderNode := keywordArgument(args, "sender", info.Source)
+			if senderNode == nil {
+				return
+			}
+			sender, ok := resolveModelName(nodeText(info.Source, senderNode), info, info.ModuleImports, info.FromImports, moduleMap)
+			if label, isString := stringLiteralValue(senderNode, info.Source); isString {
+				sender, ok = resolveModelLabel(label, info.ModulePath, modelsByName)
+			}
+			if !ok {
+				return
+			}
+			for _, signal := range signals {
+				receivers = append(receivers, SignalReceiver{Signal: signal, Sender: sender, Target: target})
+			}
+		}
+		walk(info.Tree.RootNode(), func(n *sitter.Node) {
+			switch n.Type() {
+			case "decorated_definition":
+				def := n.ChildByFieldName("definition")
+				if def == nil || def.Type() != "function_definition" {
+					return
+				}
+				name, ok := functionNames[def.ID()]
+				if !ok {
+					return
+				}
+				for i := 0; i < int(n.NamedChildCount()); i++ {
+					decorator := n.NamedChild(i)
+					if decorator == nil || decorator.Type() != "decorator" {
+						continue
+					}
+					call := unwrapCallNode(decorator.NamedChild(0))
+					if call == nil {
+						continue
+					}
+					fnText := nodeText(info.Source, call.ChildByFieldName("function"))
+					if fnText != "receiver" && !strings.HasSuffix(fnText, ".receiver") {
+						continue
+					}
+					args := call.ChildByFieldName("arguments")
+					positional := positionalArguments(args)
+					if len(positional) == 0 {
+						continue
+					}
+					register(signalNames(positional[0], info.Source), args, CallResolution{Module: info.ModulePath, Func: name})
+				}
+			case "call":
+				fnNode := n.ChildByFieldName("function")
+				if fnNode == nil || fnNode.Type() != "attribute" {
+					return
+				}
+				if nodeText(info.Source, fnNode.ChildByFieldName("attribute")) != "connect" {
+					return
+				}
+				signals := signalNames(fnNode.ChildByFieldName("object"), info.Source)
+				args := n.ChildByFieldName("arguments")
+				positional := positionalArguments(args)
+				if len(signals) == 0 || len(positional) == 0 {
+					return
+				}
+				target, _, ok := resolveFunctionReference(nodeText(info.Source, positional[0]), info, moduleMap, "", getModuleInfo)
+				if !ok {
+					return
+				}
+				register(signals, args, target)
+			}
+		})
+	}
+	return receivers
+}
+
+func signalNames(node *sitter.Node, source []byte) []string {
+	if node == nil {
+		return nil
+	}
+	switch node.Type() {
+	case "identifier", "attribute":
+		text := nodeText(source, node)
+		if idx := strings.LastIndex(text, "."); idx >= 0 {
+			text = text[idx+1:]
+		}
+		return []string{text}
+	case "list", "tuple":
+		names := []string{}
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			names = append(names, signalNames(node.NamedChild(i), source)...)
+		}
+		return names
+	}
+	return nil
+}
+
+func positionalArguments(args *sitter.Node) []*sitter.Node {
+	if args == nil {
+		return nil
+	}
+	positional := []*sitter.Node{}
+	for i := 0; i < int(args.NamedChildCount()); i++ {
+		child := args.NamedChild(i)
+		if child == nil {
+			continue
+		}
+		switch child.Type() {
+		case "keyword_argument", "list_splat", "dictionary_splat", "comment":
+			continue
+		}
+		positional = append(positional, child)
+	}
+	return positional
+}
+
+func keywordArgument(args *sitter.Node, name string, source []byte) *sitter.Node {
+	if args == nil {
+		return nil
+	}
+	for i := 0; i < int(args.NamedChildCount()); i++ {
+		child := args.NamedChild(i)
+		if child == nil || child.Type() != "keyword_argument" {
+			continue
+		}
+		if nodeText(source, child.ChildByFieldName("name")) == name {
+			return child.ChildByFieldName("value")
+		}
+	}
+	return nil
+}
+
+func getEntrySeeds(moduleInfo *ModuleInfo, entryObject string, entryClass string, entryMethod string) [][3]string {
+	seeds := make([][3]string, 0)
+	if entryClass != "" {
+		if entryMethod != "" {
+			if methods, ok := moduleInfo.Classes[entryClass]; ok {
+				if _, ok := methods[entryMethod]; ok {
+					seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryClass, entryMethod})
+				}
+			}
+			return seeds
+		}
+		if methods, ok := moduleInfo.Classes[entryClass]; ok {
+			for method := range methods {
+				seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryClass, method})
+			}
+		}
+		return seeds
+	}
+
+	if entryObject == "" {
+		for fn := range moduleInfo.Functions {
+			seeds = append(seeds, [3]string{moduleInfo.ModulePath, "", fn})
+		}
+		for className, methods := range moduleInfo.Classes {
+			for method := range methods {
+				seeds = append(seeds, [3]string{moduleInfo.ModulePath, className, method})
+			}
+		}
+		return seeds
+	}
+
+	if _, ok := moduleInfo.Functions[entryObject]; ok {
+		seeds = append(seeds, [3]string{moduleInfo.ModulePath, "", entryObject})
+		return seeds
+	}
+	if methods, ok := moduleInfo.Classes[entryObject]; ok {
+		for method := range methods {
+			seeds = append(seeds, [3]string{moduleInfo.ModulePath, entryObject, method})
+		}
+		return seeds
+	}
+	if idx := strings.LastIndex(entryObject, "."); idx > 0 {
+		className := entryObject[:idx]
+		method := entryObject[idx+1:]
+		if _, ok := moduleInfo.Classes[className][method]; ok {
+			seeds = append(seeds, [3]string{moduleInfo.ModulePath, className, method})
+		}
+	}
+	return seeds
+}
+
+type ModelRelation struct {
+	From        ModelRef
+	Field       string
+	Kind        string
+	To          ModelRef
+	RelatedName string
+}
+
+var relationFieldKinds = map[string]struct{}{
+	"ForeignKey":      {},
+	"OneToOneField":   {},
+	"ManyToManyField": {},
+	"ParentalKey":     {},
+	"relationship":    {},
+}
+
+func buildRelationGraph(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []ModelRelation {
+	modulePaths := make([]string, 0, len(moduleMap))
+	for modulePath := range moduleMap {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	type pendingRelation struct {
+		def      classDefinition
+		relation ModelRelation
+		target   *sitter.Node
+	}
+	modelsByName := map[string][]ModelRef{}
+	pending := []pendingRelation{}
+	for _, modulePath := range modulePaths {
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil {
+			continue
+		}
+		classNames := make([]string, 0, len(info.ClassAttrs))
+		for className := range info.ClassAttrs {
+			classNames = append(classNames, className)
+		}
+		sort.Strings(classNames)
+		for _, className := range classNames {
+			if !isModelClass(info.IsSQLAlchemyModel, modulePath, className) {
+				continue
+			}
+			from := ModelRef{Module: modulePath, Name: className}
+			isModel := false
+			attrs := info.ClassAttrs[className]
+			fieldNames := make([]string, 0, len(attrs))
+			for fieldName := range attrs {
+				fieldNames = append(fieldNames, fieldName)
+			}
+			sort.Strings(fieldNames)
+			for _, field := range fieldNames {
+				fieldType, ok := modelFieldType(attrs[field], info.Source)
+				if !ok {
+					continue
+				}
+				isModel = true
+				if _, ok := relationFieldKinds[fieldType]; !ok {
+					continue
+				}
+				args := unwrapCallNode(attrs[field]).ChildByFieldName("arguments")
+				target := keywordArgument(args, "to", info.Source)
+				if target == nil {
+					target = keywordArgument(args, "argument", info.Source)
+				}
+				if target == nil {
+					if positional := positionalArguments(args); len(positional) > 0 {
+						target = positional[0]
+					}
+				}
+				if target == nil {
+					continue
+				}
+				relatedName := ""
+				for _, keyword := range []string{"related_name", "backref", "back_populates"} {
+					if value, ok := stringLiteralValue(keywordArgument(args, keyword, info.Source), info.Source); ok {
+						relatedName = value
+						break
+					}
+				}
+				pending = append(pending, pendingRelation{
+					def:      classDefinition{Info: info, Name: className},
+					relation: ModelRelation{From: from, Field: field, Kind: fieldType, RelatedName: relatedName},
+					target:   target,
+				})
+			}
+			if isModel {
+				modelsByName[className] = append(modelsByName[className], from)
+			}
+		}
+	}
+
+	relations := make([]ModelRelation, 0, len(pending))
+	for _, item := range pending {
+		to, ok := resolveRelationTarget(item.target, item.def, item.relation.From, modelsByName, moduleMap, getModuleInfo)
+		if !ok {
+			continue
+		}
+		item.relation.To = to
+		relations = append(relations, item.relation)
+	}
+	return relations
+}
+
+func resolveRelationTarget(node *sitter.Node, def classDefinition, from ModelRef, modelsByName map[string][]ModelRef, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (ModelRef, bool) {
+	value, isString := stringLiteralValue(node, def.Info.Source)
+	if !isString {
+		target, ok := resolveClassReference(nodeText(def.Info.Source, node), def.Info, moduleMap, getModuleInfo)
+		if !ok {
+			return ModelRef{}, false
+		}
+		return ModelRef{Module: target.Info.ModulePath, Name: target.Name}, true
+	}
+	if value == "self" {
+		return from, true
+	}
+	return resolveModelLabel(value, from.Module, modelsByName)
+}
+
+func resolveModelLabel(value string, fromModule string, modelsByName map[string][]ModelRef) (ModelRef, bool) {
+	appLabel := ""
+	name := value
+	if idx := strings.LastIndex(value, "."); idx >= 0 {
+		appLabel = value[:idx]
+		name = value[idx+1:]
+	}
+	candidates := modelsByName[name]
+	if len(candidates) == 0 {
+		return ModelRef{}, false
+	}
+	for _, candidate := range candidates {
+		if appLabel == "" && candidate.Module == fromModule {
+			return candidate, true
+		}
+		if appLabel != "" && containsString(strings.Split(candidate.Module, "."), appLabel) {
+			return candidate, true
+		}
+	}
+	if appLabel != "" {
+		return ModelRef{}, false
+	}
+	return candidates[0], true
+}
+
+func (r ModelRelation) reverseAccessor() string {
+	if r.RelatedName != "" {
+		return r.RelatedName
+	}
+	if r.Kind == "relationship" {
+		return ""
+	}
+	name := r.From.Name
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if r.Kind == "OneToOneField" {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "_set"
+}
+
+func followRelation(relations []ModelRelation, model ModelRef, accessor string, getModuleInfo func(string) (*ModuleInfo, error)) (ModelRef, bool) {
+	for _, relation := range relations {
+		if relation.Field == accessor && sameModel(relation.From, model, getModuleInfo) {
+			return relation.To, true
+		}
+	}
+	for _, relation := range relations {
+		if sameModel(relation.To, model, getModuleInfo) && relation.reverseAccessor() == accessor {
+			return relation.From, true
+		}
+	}
+	return ModelRef{}, false
+}
+
+func relatedModelPaths(op modelOperation, source []byte) [][]string {
+	if op.Call == nil || (op.Op != "select_related" && op.Op != "prefetch_related") {
+		return nil
+	}
+	paths := [][]string{}
+	for _, arg := range positionalArguments(op.Call.ChildByFieldName("arguments")) {
+		if value, ok := stringLiteralValue(arg, source); ok && value != "" {
+			paths = append(paths, strings.Split(value, "__"))
+		}
+	}
+	return paths
+}
+
+func runRelations(args []string) {
+	flags := flag.NewFlagSet("relations", flag.ExitOnError)
+	rootFlag := flags.String("root", "", "Python source root (base directory containing package roots).")
+	modelFilter := flags.String("model", "", "Only show relations touching this model (Name or module.Name).")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "modex relations prints the relation graph between models.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  modex relations [--root <path>] [--model <name>]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	root := *rootFlag
+	if root == "" {
+		root = getRoot()
+	}
+	moduleMap, mapErrors := buildModuleMapForRoots(root)
+	if len(mapErrors) > 0 {
+		for _, err := range mapErrors {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+		os.Exit(2)
+	}
+	getModuleInfo := newModuleLoader(moduleMap)
+
+	matches := func(model ModelRef) bool {
+		return *modelFilter == "" || model.Name == *modelFilter || model.String() == *modelFilter
+	}
+	lines := []string{}
+	for _, relation := range buildRelationGraph(moduleMap, getModuleInfo) {
+		if !matches(relation.From) && !matches(relation.To) {
+			continue
+		}
+		detail := relation.Kind
+		if relation.RelatedName != "" {
+			detail += ", related_name=" + relation.RelatedName
+		}
+		lines = append(lines, fmt.Sprintf("%s.%s -> %s (%s)", relation.From, relation.Field, relation.To, detail))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+var lintRules = map[string]TraceOptions{
+	"n-plus-one":        {NPlusOne: true},
+	"sync-orm-in-async": {SyncInAsync: true},
+}
+
+func runLint(args []string) {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	entrypoint := flags.String("entrypoint", "", "Entrypoint like 'pkg.module:MyClass' or 'src/path/file.py:MyClass::method'")
+	rootFlag := flags.String("root", "", "Python source root (base directory containing package roots).")
+	flags.Usage = func() {
+		rules := make([]string, 0, len(lintRules))
+		for rule := range lintRules {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+		fmt.Fprintln(os.Stderr, "modex lint reports problems found along the paths traced from an entrypoint.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  modex lint <rule> --entrypoint <module-or-path[:object]> [--root <path>]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintf(os.Stderr, "Rules: %s\n", strings.Join(rules, ", "))
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	rule := args[0]
+	options, ok := lintRules[rule]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown lint rule %q\n", rule)
+		os.Exit(2)
+	}
+	flags.Parse(args[1:])
+	if *entrypoint == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --entrypoint is required")
+		os.Exit(2)
+	}
+
+	root := *rootFlag
+	if root == "" {
+		root = getRoot()
+	}
+	result, errors := collectModelsForEntrypoint(*entrypoint, root, options)
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+		os.Exit(2)
+	}
+
+	findings := []LintFinding{}
+	for _, finding := range result.Findings {
+		if finding.Rule == rule {
+			findings = append(findings, finding)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File == findings[j].File {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].File < findings[j].File
+	})
+	for _, finding := range findings {
+		fmt.Printf("%s:%d: %s [%s]\n", finding.File, finding.Line, finding.Message, finding.Rule)
+		fmt.Printf("  via %s\n", strings.Join(finding.Chain, " -> "))
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+func resolveModelTable(model ModelRef, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) (string, bool) {
+	def, ok := resolveClassDefinition(ClassRef{Module: model.Module, Name: model.Name}, moduleMap, getModuleInfo, 0)
+	if !ok {
+		return "", false
+	}
+	return modelTableName(def, moduleMap, getModuleInfo, 0)
+}
+
+func modelTableName(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (string, bool) {
+	if depth > 8 {
+		return "", false
+	}
+	source := def.Info.Source
+	attrs := def.Info.ClassAttrs[def.Name]
+	if value, ok := stringLiteralValue(attrs["__tablename__"], source); ok {
+		return value, true
+	}
+	if table := unwrapCallNode(attrs["__table__"]); table != nil {
+		if positional := positionalArguments(table.ChildByFieldName("arguments")); len(positional) > 0 {
+			if value, ok := stringLiteralValue(positional[0], source); ok {
+				return value, true
+			}
+		}
+	}
+	meta := def.Info.ClassAttrs[def.Name+".Meta"]
+	if value, ok := stringLiteralValue(meta["db_table"], source); ok {
+		return value, true
+	}
+	if proxy := meta["proxy"]; proxy != nil && nodeText(source, proxy) == "True" {
+		for _, base := range def.Info.ClassBases[def.Name] {
+			if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok {
+				return modelTableName(parent, moduleMap, getModuleInfo, depth+1)
+			}
+		}
+	}
+	name := def.Name
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if isSQLAlchemyClass(def) {
+		// A SQLAlchemy subclass without a table of its own shares its parent's
+		// (single-table inheritance); Flask-SQLAlchemy otherwise names the
+		// table after the class.
+		for _, base := range def.Info.ClassBases[def.Name] {
+			if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok {
+				if isSQLAlchemyClass(parent) {
+					return modelTableName(parent, moduleMap, getModuleInfo, depth+1)
+				}
+			}
+		}
+		return snakeCase(name), true
+	}
+	appLabel, ok := stringLiteralValue(meta["app_label"], source)
+	if !ok {
+		appLabel = defaultAppLabel(def.Info.ModulePath)
+	}
+	if appLabel == "" {
+		return strings.ToLower(name), true
+	}
+	return appLabel + "_" + strings.ToLower(name), true
+}
+
+func isSQLAlchemyClass(def classDefinition) bool {
+	return def.Info.IsSQLAlchemyModel != nil && def.Info.IsSQLAlchemyModel(ModelRef{Module: def.Info.ModulePath, Name: def.Name})
+}
+
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var out strings.Builder
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 {
+			prev := runes[i-1]
+			prevLower := (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9')
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			if prevLower || (prev >= 'A' && prev <= 'Z' && nextLower) {
+				out.WriteByte('_')
+			}
+		}
+		if upper {
+			r += 'a' - 'A'
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+func defaultAppLabel(modulePath string) string {
+	parts := strings.Split(modulePath, ".")
+	for i, part := range parts {
+		if part == "models" && i > 0 {
+			return parts[i-1]
+		}
+	}
+	return ""
+}
+
+var dtoDecorators = map[string]string{
+	"dataclasses.dataclass":          "dataclass",
+	"pydantic.dataclasses.dataclass": "pydantic",
+	"attr.s":                         "attrs",
+	"attr.attrs":                     "attrs",
+	"attr.define":                    "attrs",
+	"attr.frozen":                    "attrs",
+	"attr.mutable":                   "attrs",
+	"attr.dataclass":                 "attrs",
+	"attrs.define":                   "attrs",
+	"attrs.frozen":                   "attrs",
+	"attrs.mutable":                  "attrs",
+}
+
+var dtoBases = map[string]string{
+	"pydantic.BaseModel":          "pydantic",
+	"pydantic.main.BaseModel":     "pydantic",
+	"pydantic.v1.BaseModel":       "pydantic",
+	"typing.TypedDict":            "TypedDict",
+	"typing_extensions.TypedDict": "TypedDict",
+}
+
+func importedName(text string, info *ModuleInfo) string {
+	return scopedImportedName(text, info.ModuleImports, info.FromImports)
+}
+
+func scopedImportedName(text string, moduleImports map[string]string, fromImports map[string]ImportFromTarget) string {
+	head, rest := text, ""
+	if idx := strings.Index(text, "."); idx >= 0 {
+		head, rest = text[:idx], text[idx:]
+	}
+	if target, ok := fromImports[head]; ok {
+		return target.Module + "." + target.Name + rest
+	}
+	for prefix := text; prefix != ""; {
+		if modulePath, ok := moduleImports[prefix]; ok {
+			return modulePath + strings.TrimPrefix(text, prefix)
+		}
+		idx := strings.LastIndex(prefix, ".")
+		if idx < 0 {
+			break
+		}
+		prefix = prefix[:idx]
+	}
+	return text
+}
+
+func dtoKind(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (string, bool) {
+	if depth > 8 {
+		return "", false
+	}
+	for _, decorator := range def.Info.ClassDecorators[def.Name] {
+		name := strings.TrimSpace(strings.SplitN(decorator, "(", 2)[0])
+		if kind, ok := dtoDecorators[importedName(name, def.Info)]; ok {
+			return kind, true
+		}
+	}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		if kind, ok := dtoBases[importedName(base, def.Info)]; ok {
+			return kind, true
+		}
+		if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok && parent != def {
+			if kind, ok := dtoKind(parent, moduleMap, getModuleInfo, depth+1); ok {
+				return kind, true
+			}
+		}
+	}
+	return "", false
+}
+
+func collectClassReferences(functionNode *sitter.Node, moduleInfo *ModuleInfo, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []classDefinition {
+	texts := map[string]struct{}{}
+	nodes := []*sitter.Node{functionNode}
+	if parent := functionNode.Parent(); parent != nil && parent.Type() == "decorated_definition" {
+		for i := 0; i < int(parent.NamedChildCount()); i++ {
+			if decorator := parent.NamedChild(i); decorator.Type() == "decorator" {
+				nodes = append(nodes, decorator)
+			}
+		}
+	}
+	for _, node := range nodes {
+		usage := collectUsage(node, moduleInfo.Source)
+		for name := range usage.Names {
+			texts[name] = struct{}{}
+		}
+		for _, item := range usage.Attrs {
+			texts[item[0]+"."+item[1]] = struct{}{}
+		}
+	}
+	defs := []classDefinition{}
+	seen := map[classDefinition]struct{}{}
+	for text := range texts {
+		def, ok := resolveClassReference(text, moduleInfo, moduleMap, getModuleInfo)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[def]; !ok {
+			seen[def] = struct{}{}
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+type MessageUse uint8
+
+const (
+	MessageBuilt MessageUse = 1 << iota
+	MessageReferenced
+)
+
+func (u MessageUse) String() string {
+	switch {
+	case u&MessageBuilt != 0 && u&MessageReferenced != 0:
+		return "built, referenced"
+	case u&MessageBuilt != 0:
+		return "built"
+	}
+	return "referenced"
+}
+
+func isProtobufModule(modulePath string) bool {
+	return strings.HasSuffix(modulePath, "_pb2")
+}
+
+func collectMessageReferences(functionNode *sitter.Node, moduleInfo *ModuleInfo) map[ClassRef]MessageUse {
+	moduleImports, fromImports := collectScopedImports(functionNode, moduleInfo)
+	messages := map[ClassRef]MessageUse{}
+	record := func(n *sitter.Node, ref ClassRef) {
+		if strings.ToUpper(ref.Name) == ref.Name {
+			return
+		}
+		use := MessageReferenced
+		if parent := n.Parent(); parent != nil && parent.Type() == "call" && fieldName(parent, n) == "function" {
+			use = MessageBuilt
+		}
+		messages[ref] |= use
+	}
+	walk(functionNode, func(n *sitter.Node) {
+		switch n.Type() {
+		case "identifier":
+			if parent := n.Parent(); parent != nil && parent.Type() == "attribute" && fieldName(parent, n) == "attribute" {
+				return
+			}
+			if !shouldCountIdentifier(n) {
+				return
+			}
+			if target, ok := fromImports[nodeText(moduleInfo.Source, n)]; ok && isProtobufModule(target.Module) {
+				record(n, ClassRef{Module: target.Module, Name: target.Name})
+			}
+		case "attribute":
+			obj := n.ChildByFieldName("object")
+			attr := n.ChildByFieldName("attribute")
+			if obj == nil || attr == nil || obj.Type() != "identifier" {
+				return
+			}
+			base := nodeText(moduleInfo.Source, obj)
+			modulePath, ok := moduleImports[base]
+			if target, isFrom := fromImports[base]; !ok && isFrom {
+				modulePath = target.Module + "." + target.Name
+			}
+			if isProtobufModule(modulePath) {
+				record(n, ClassRef{Module: modulePath, Name: nodeText(moduleInfo.Source, attr)})
+			}
+		}
+	})
+	return messages
+}
+
+type SideEffect struct {
+	Kind   string
+	Call   string
+	Target string
+}
+
+type sideEffectPattern struct {
+	Prefix string
+	Kind   string
+}
+
+var defaultSideEffectPatterns = []sideEffectPattern{
+	{Prefix: "requests", Kind: "http"},
+	{Prefix: "httpx", Kind: "http"},
+	{Prefix: "urllib3", Kind: "http"},
+	{Prefix: "urllib.request", Kind: "http"},
+	{Prefix: "aiohttp", Kind: "http"},
+	{Prefix: "boto3", Kind: "aws"},
+	{Prefix: "aioboto3", Kind: "aws"},
+	{Prefix: "redis", Kind: "redis"},
+	{Prefix: "kafka", Kind: "kafka"},
+	{Prefix: "aiokafka", Kind: "kafka"},
+	{Prefix: "confluent_kafka", Kind: "kafka"},
+	{Prefix: "smtplib", Kind: "smtp"},
+	{Prefix: "django.core.mail", Kind: "email"},
+}
+
+func parseSideEffectPatterns(spec string) ([]sideEffectPattern, error) {
+	patterns := []sideEffectPattern{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, kind, _ := strings.Cut(entry, "=")
+		prefix, kind = strings.TrimSpace(prefix), strings.TrimSpace(kind)
+		if prefix == "" {
+			return nil, fmt.Errorf("invalid side effect pattern %q", entry)
+		}
+		if kind == "" {
+			kind = "external"
+		}
+		patterns = append(patterns, sideEffectPattern{Prefix: prefix, Kind: kind})
+	}
+	return patterns, nil
+}
+
+func sideEffectKind(name string, patterns []sideEffectPattern) (string, bool) {
+	last := name[strings.LastIndex(name, ".")+1:]
+	if strings.HasSuffix(last, "Error") || strings.HasSuffix(last, "Exception") {
+		return "", false
+	}
+	kind, matched := "", -1
+	for _, pattern := range patterns {
+		if (name == pattern.Prefix || strings.HasPrefix(name, pattern.Prefix+".")) && len(pattern.Prefix) >= matched {
+			kind, matched = pattern.Kind, len(pattern.Prefix)
+		}
+	}
+	return kind, matched >= 0
+}
+
+var clientFactories = map[string]struct{}{
+	"client": {}, "resource": {}, "session": {}, "from_url": {},
+}
+
+func isClientFactory(call string) bool {
+	last := call[strings.LastIndex(call, ".")+1:]
+	if _, ok := clientFactories[last]; ok {
+		return true
+	}
+	return last != "" && last[0] >= 'A' && last[0] <= 'Z'
+}
+
+var sideEffectTargetKeywords = []string{"url", "base_url", "endpoint_url", "host", "hostname", "bootstrap_servers", "service_name"}
+
+func sideEffectTarget(call string, args *sitter.Node, source []byte, assigned map[string]*sitter.Node) string {
+	for _, name := range sideEffectTargetKeywords {
+		if value, ok := sqlStringValue(keywordArgument(args, name, source), source, assigned, 0); ok {
+			return value
+		}
+	}
+	positional := positionalArguments(args)
+	if len(positional) == 0 {
+		return ""
+	}
+	value, ok := sqlStringValue(positional[0], source, assigned, 0)
+	if !ok {
+		return ""
+	}
+	if method := call[strings.LastIndex(call, ".")+1:]; method == "client" || method == "resource" {
+		return value
+	}
+	if looksLikeEndpoint(value) {
+		return value
+	}
+	return ""
+}
+
+func looksLikeEndpoint(value string) bool {
+	if value == "" || strings.ContainsAny(value, " \t\n") {
+		return false
+	}
+	if strings.Contains(value, "://") || strings.Contains(value, "/") {
+		return true
+	}
+	host, port, hasPort := strings.Cut(value, ":")
+	if hasPort && strings.Trim(port, "0123456789") != "" {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || strings.Trim(label, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func collectSideEffects(functionNode *sitter.Node, moduleInfo *ModuleInfo, patterns []sideEffectPattern) map[SideEffect]struct{} {
+	source := moduleInfo.Source
+	moduleImports, fromImports := collectScopedImports(functionNode, moduleInfo)
+	assigned := map[string]*sitter.Node{}
+	clients := map[string]SideEffect{}
+
+	var effectOf func(call *sitter.Node) (SideEffect, bool)
+	effectOf = func(call *sitter.Node) (SideEffect, bool) {
+		fnNode := call.ChildByFieldName("function")
+		if fnNode == nil {
+			return SideEffect{}, false
+		}
+		args := call.ChildByFieldName("arguments")
+		var effect SideEffect
+		if fnNode.Type() == "attribute" {
+			if obj := fnNode.ChildByFieldName("object"); obj != nil {
+				var client SideEffect
+				found := false
+				switch obj.Type() {
+				case "identifier":
+					client, found = clients[nodeText(source, obj)]
+				case "call":
+					client, found = effectOf(obj)
+				}
+				if found {
+					effect = client
+					effect.Call += "." + nodeText(source, fnNode.ChildByFieldName("attribute"))
+				}
+			}
+		}
+		if effect.Call == "" {
+			name := scopedImportedName(nodeText(source, fnNode), moduleImports, fromImports)
+			kind, ok := sideEffectKind(name, patterns)
+			if !ok {
+				return SideEffect{}, false
+			}
+			effect = SideEffect{Kind: kind, Call: name}
+		}
+		if target := sideEffectTarget(effect.Call, args, source, assigned); target != "" {
+			if strings.HasPrefix(target, "/") && strings.Contains(effect.Target, "://") {
+				target = strings.TrimSuffix(effect.Target, "/") + target
+			}
+			effect.Target = target
+		}
+		return effect, true
+	}
+	recordClient := func(name *sitter.Node, value *sitter.Node) {
+		if name == nil || value == nil || name.Type() != "identifier" {
+			return
+		}
+		if value.Type() == "await" && value.NamedChildCount() > 0 {
+			value = value.NamedChild(0)
+		}
+		if value.Type() != "call" {
+			return
+		}
+		if effect, ok := effectOf(value); ok && isClientFactory(effect.Call) {
+			clients[nodeText(source, name)] = effect
+		}
+	}
+
+	if moduleInfo.Tree != nil {
+		root := moduleInfo.Tree.RootNode()
+		for i := 0; i < int(root.NamedChildCount()); i++ {
+			statement := root.NamedChild(i)
+			if statement.Type() != "expression_statement" || statement.NamedChildCount() == 0 {
+				continue
+			}
+			if assignment := statement.NamedChild(0); assignment.Type() == "assignment" {
+				left := assignment.ChildByFieldName("left")
+				right := assignment.ChildByFieldName("right")
+				if left != nil && right != nil && left.Type() == "identifier" {
+					assigned[nodeText(source, left)] = right
+				}
+				recordClient(left, right)
+			}
+		}
+	}
+	walk(functionNode, func(n *sitter.Node) {
+		switch n.Type() {
+		case "assignment":
+			left := n.ChildByFieldName("left")
+			right := n.ChildByFieldName("right")
+			if left != nil && right != nil && left.Type() == "identifier" {
+				assigned[nodeText(source, left)] = right
+			}
+			recordClient(left, right)
+		case "as_pattern":
+			if alias := n.ChildByFieldName("alias"); alias != nil && n.NamedChildCount() > 0 {
+				if alias.Type() != "identifier" && alias.NamedChildCount() > 0 {
+					alias = alias.NamedChild(0)
+				}
+				recordClient(alias, n.NamedChild(0))
+			}
+		}
+	})
+
+	effects := map[SideEffect]struct{}{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "call" {
+			return
+		}
+		if effect, ok := effectOf(n); ok {
+			effects[effect] = struct{}{}
+		}
+	})
+	return effects
+}
+
+type SettingRef struct {
+	Source string
+	Key    string
+}
+
+var envReaders = map[string]struct{}{
+	"os.getenv":             {},
+	"os.environ.get":        {},
+	"os.environ.setdefault": {},
+}
+
+func isSettingsObject(name string) bool {
+	if strings.HasPrefix(name, "self.") || strings.HasPrefix(name, "cls.") {
+		return false
+	}
+	return name == "settings" || strings.HasSuffix(name, ".settings")
+}
+
+func isSettingName(name string) bool {
+	return strings.ToUpper(name) == name && strings.ToLower(name) != name
+}
+
+func collectSettingsReads(functionNode *sitter.Node, moduleInfo *ModuleInfo) map[SettingRef]struct{} {
+	source := moduleInfo.Source
+	moduleImports, fromImports := collectScopedImports(functionNode, moduleInfo)
+	resolve := func(n *sitter.Node) string {
+		return scopedImportedName(nodeText(source, n), moduleImports, fromImports)
+	}
+	firstKey := func(args *sitter.Node, index int) (string, bool) {
+		positional := positionalArguments(args)
+		if len(positional) <= index {
+			return "", false
+		}
+		return stringLiteralValue(positional[index], source)
+	}
+	reads := map[SettingRef]struct{}{}
+	walk(functionNode, func(n *sitter.Node) {
+		switch n.Type() {
+		case "attribute":
+			obj := n.ChildByFieldName("object")
+			attr := nodeText(source, n.ChildByFieldName("attribute"))
+			if obj == nil || !isSettingName(attr) || !isSettingsObject(resolve(obj)) {
+				return
+			}
+			if parent := n.Parent(); parent != nil && parent.Type() == "assignment" && fieldName(parent, n) == "left" {
+				return
+			}
+			reads[SettingRef{Source: "setting", Key: attr}] = struct{}{}
+		case "subscript":
+			if value := n.ChildByFieldName("value"); value == nil || resolve(value) != "os.environ" {
+				return
+			}
+			if parent := n.Parent(); parent != nil && parent.Type() == "assignment" && fieldName(parent, n) == "left" {
+				return
+			}
+			if key, ok := stringLiteralValue(n.ChildByFieldName("subscript"), source); ok {
+				reads[SettingRef{Source: "env", Key: key}] = struct{}{}
+			}
+		case "call":
+			fnNode := n.ChildByFieldName("function")
+			if fnNode == nil {
+				return
+			}
+			args := n.ChildByFieldName("arguments")
+			callee := resolve(fnNode)
+			switch {
+			case callee == "getattr":
+				positional := positionalArguments(args)
+				if len(positional) < 2 || !isSettingsObject(resolve(positional[0])) {
+					return
+				}
+				if key, ok := firstKey(args, 1); ok {
+					reads[SettingRef{Source: "setting", Key: key}] = struct{}{}
+				}
+			case callee == "decouple.config":
+				if key, ok := firstKey(args, 0); ok {
+					reads[SettingRef{Source: "config", Key: key}] = struct{}{}
+				}
+			default:
+				if _, ok := envReaders[callee]; !ok {
+					return
+				}
+				if key, ok := firstKey(args, 0); ok {
+					reads[SettingRef{Source: "env", Key: key}] = struct{}{}
+				}
+			}
+		}
+	})
+	return reads
+}
+
+var rawSQLMethods = map[string]struct{}{
+	"execute":         {},
+	"executemany":     {},
+	"executescript":   {},
+	"exec_driver_sql": {},
+	"raw":             {},
+	"fetch":           {},
+	"fetchrow":        {},
+	"fetchval":        {},
+}
+
+func sqlStringValue(node *sitter.Node, source []byte, assigned map[string]*sitter.Node, depth int) (string, bool) {
+	if node == nil || depth > 8 {
+		return "", false
+	}
+	switch node.Type() {
+	case "string":
+		if value, ok := stringLiteralValue(node, source); ok {
+			return value, true
+		}
+		return formatStringLiteralParts(node, source), true
+	case "concatenated_string":
+		parts := []string{}
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			if value, ok := sqlStringValue(node.NamedChild(i), source, assigned, depth+1); ok {
+				parts = append(parts, value)
+			}
+		}
+		return strings.Join(parts, ""), len(parts) > 0
+	case "binary_operator":
+		left, leftOK := sqlStringValue(node.ChildByFieldName("left"), source, assigned, depth+1)
+		right, rightOK := sqlStringValue(node.ChildByFieldName("right"), source, assigned, depth+1)
+		if !leftOK && !rightOK {
+			return "", false
+		}
+		if !leftOK {
+			left = "?"
+		}
+		if !rightOK {
+			right = "?"
+		}
+		return left + right, true
+	case "parenthesized_expression":
+		return sqlStringValue(node.NamedChild(0), source, assigned, depth+1)
+	case "identifier":
+		if value, ok := assigned[nodeText(source, node)]; ok {
+			return sqlStringValue(value, source, assigned, depth+1)
+		}
+	case "call":
+		callee := nodeText(source, node.ChildByFieldName("function"))
+		if callee == "text" || strings.HasSuffix(callee, ".text") {
+			if positional := positionalArguments(node.ChildByFieldName("arguments")); len(positional) > 0 {
+				return sqlStringValue(positional[0], source, assigned, depth+1)
+			}
+		}
+	}
+	return "", false
+}
+
+func formatStringLiteralParts(node *sitter.Node, source []byte) string {
+	var builder strings.Builder
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		switch child.Type() {
+		case "string_content":
+			builder.WriteString(nodeText(source, child))
+		case "interpolation":
+			builder.WriteString("?")
+		}
+	}
+	return builder.String()
+}
+
+func sqlTableReferences(sql string) map[string]AccessMode {
+	tokens := sqlTokens(sql)
+	tables := map[string]AccessMode{}
+	for len(tokens) > 0 && tokens[0] == "(" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return tables
+	}
+	switch strings.ToUpper(tokens[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "REPLACE", "MERGE":
+	default:
+		return tables
+	}
+	// EXTRACT(YEAR FROM created) and friends use FROM inside their
+	// parentheses; a stack of open parentheses tracks whether we are in one.
+	var parens []bool
+	ctes := map[string]struct{}{}
+	inFunction := func() bool {
+		for _, function := range parens {
+			if function {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToUpper(tokens[i])
+		mode := AccessRead
+		switch keyword {
+		case "(":
+			function := false
+			if i > 0 {
+				_, function = sqlFromFunctions[strings.ToUpper(tokens[i-1])]
+			}
+			parens = append(parens, function)
+			continue
+		case ")":
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+			continue
+		case "FROM":
+			previous := ""
+			if i > 0 {
+				previous = strings.ToUpper(tokens[i-1])
+			}
+			if inFunction() || previous == "DISTINCT" {
+				continue
+			}
+			if previous == "DELETE" {
+				mode = AccessWrite
+			}
+		case "JOIN":
+		case "INTO", "UPDATE":
+			// ON DUPLICATE KEY UPDATE and ON CONFLICT DO UPDATE set columns.
+			if i > 0 && (strings.ToUpper(tokens[i-1]) == "KEY" || strings.ToUpper(tokens[i-1]) == "DO") {
+				continue
+			}
+			mode = AccessWrite
+		case "AS":
+			if name, ok := sqlCTEName(tokens, i); ok {
+				ctes[strings.ToLower(name)] = struct{}{}
+			}
+			continue
+		default:
+			continue
+		}
+		for j := i + 1; j < len(tokens); j++ {
+			name := sqlIdentifier(tokens[j])
+			if name == "" {
+				break
+			}
+			tables[name] |= mode
+			if keyword != "FROM" {
+				break
+			}
+			next := j + 1
+			if next < len(tokens) && strings.ToUpper(tokens[next]) == "AS" {
+				next++
+			}
+			if next < len(tokens) && isSQLAlias(tokens[next]) {
+				next++
+			}
+			if next+1 >= len(tokens) || tokens[next] != "," {
+				break
+			}
+			j = next
+		}
+	}
+	for name := range tables {
+		if _, ok := ctes[strings.ToLower(name)]; ok {
+			delete(tables, name)
+		}
+	}
+	return tables
+}
+
+func sqlCTEName(tokens []string, i int) (string, bool) {
+	next := i + 1
+	for next < len(tokens) && (strings.ToUpper(tokens[next]) == "NOT" || strings.ToUpper(tokens[next]) == "MATERIALIZED") {
+		next++
+	}
+	if i == 0 || next >= len(tokens) || tokens[next] != "(" {
+		return "", false
+	}
+	before := i - 1
+	if tokens[before] == ")" {
+		for depth := 0; before >= 0; before-- {
+			if tokens[before] == ")" {
+				depth++
+			} else if tokens[before] == "(" {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		before--
+	}
+	if before < 0 {
+		return "", false
+	}
+	name := sqlIdentifier(tokens[before])
+	return name, name != ""
+}
+
+var sqlClauseWords = map[string]struct{}{
+	"WHERE": {}, "JOIN": {}, "INNER": {}, "LEFT": {}, "RIGHT": {}, "FULL": {}, "OUTER": {},
+	"CROSS": {}, "NATURAL": {}, "ON": {}, "USING": {}, "GROUP": {}, "ORDER": {}, "HAVING": {},
+	"LIMIT": {}, "OFFSET": {}, "UNION": {}, "EXCEPT": {}, "INTERSECT": {}, "FOR": {},
+	"WINDOW": {}, "RETURNING": {}, "SET": {}, "VALUES": {},
+}
+
+func isSQLAlias(token string) bool {
+	if _, ok := sqlClauseWords[strings.ToUpper(token)]; ok {
+		return false
+	}
+	return sqlIdentifier(token) != ""
+}
+
+var sqlReservedWords = map[string]struct{}{
+	"SELECT": {}, "SET": {}, "ONLY": {}, "LATERAL": {}, "WHERE": {}, "VALUES": {},
+	"UNNEST": {}, "DUAL": {}, "TABLE": {}, "IGNORE": {}, "OR": {}, "LOW_PRIORITY": {},
+	"NOWAIT": {}, "SKIP": {}, "LOCKED": {}, "OF": {},
+}
+
+var sqlFromFunctions = map[string]struct{}{
+	"EXTRACT": {}, "SUBSTRING": {}, "TRIM": {}, "POSITION": {},
+}
+
+func sqlIdentifier(token string) string {
+	name := strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(token)
+	name = strings.TrimPrefix(name, "?.")
+	if name == "" || name == "?" || strings.Contains(name, "?") || strings.HasPrefix(name, "%") || strings.HasPrefix(name, ":") {
+		return ""
+	}
+	if _, ok := sqlReservedWords[strings.ToUpper(name)]; ok {
+		return ""
+	}
+	first := name[0]
+	if !(first == '_' || (first >= 'a' && first <= 'z') || (first >= 'A' && first <= 'Z')) {
+		return ""
+	}
+	return name
+}
+
+func sqlTokens(sql string) []string {
+	tokens := []string{}
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range sql {
+		switch {
+		case r == ',' || r == '(' || r == ')' || r == ';':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type rawSQLTable struct {
+	Table string
+	Alias string
+}
+
+func collectRawSQLTables(functionNode *sitter.Node, source []byte) map[rawSQLTable]AccessMode {
+	assigned := map[string]*sitter.Node{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "assignment" {
+			return
+		}
+		left := n.ChildByFieldName("left")
+		right := n.ChildByFieldName("right")
+		if left != nil && right != nil && left.Type() == "identifier" {
+			assigned[nodeText(source, left)] = right
+		}
+	})
+	tables := map[rawSQLTable]AccessMode{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "call" {
+			return
+		}
+		fnNode := n.ChildByFieldName("function")
+		if fnNode == nil {
+			return
+		}
+		callee := nodeText(source, fnNode)
+		isText := callee == "text" || strings.HasSuffix(callee, ".text")
+		if !isText {
+			if fnNode.Type() != "attribute" {
+				return
+			}
+			if _, ok := rawSQLMethods[nodeText(source, fnNode.ChildByFieldName("attribute"))]; !ok {
+				return
+			}
+		}
+		positional := positionalArguments(n.ChildByFieldName("arguments"))
+		if len(positional) == 0 {
+			return
+		}
+		sql, ok := sqlStringValue(positional[0], source, assigned, 0)
+		if !ok {
+			return
+		}
+		alias := databaseAlias(n, functionNode, source)
+		for table, mode := range sqlTableReferences(sql) {
+			tables[rawSQLTable{Table: table, Alias: alias}] |= mode
+		}
+	})
+	return tables
+}
+
+const defaultDatabaseAlias = "default"
+
+func databaseAlias(callNode *sitter.Node, functionNode *sitter.Node, source []byte) string {
+	if alias := chainDatabaseAlias(callNode, source); alias != "" {
+		return alias
+	}
+	for parent := callNode.Parent(); parent != nil && parent != functionNode; parent = parent.Parent() {
+		switch parent.Type() {
+		case "lambda", "function_definition":
+			// Callbacks such as on_commit run later on the default connection.
+			return defaultDatabaseAlias
+		case "with_statement":
+		default:
+			continue
+		}
+		for i := 0; i < int(parent.NamedChildCount()); i++ {
+			clause := parent.NamedChild(i)
+			if clause.Type() == "block" {
+				continue
+			}
+			if alias := firstDatabaseAlias(clause, source); alias != "" {
+				return alias
+			}
+		}
+	}
+	if decorated := functionNode.Parent(); decorated != nil && decorated.Type() == "decorated_definition" {
+		for i := 0; i < int(decorated.NamedChildCount()); i++ {
+			if decorator := decorated.NamedChild(i); decorator.Type() == "decorator" {
+				if alias := firstDatabaseAlias(decorator, source); alias != "" {
+					return alias
+				}
+			}
+		}
+	}
+	return defaultDatabaseAlias
+}
+
+func firstDatabaseAlias(node *sitter.Node, source []byte) string {
+	alias := ""
+	walk(node, func(n *sitter.Node) {
+		if alias == "" && (n.Type() == "call" || n.Type() == "subscript") {
+			alias = chainDatabaseAlias(n, source)
+		}
+	})
+	return alias
+}
+
+func chainDatabaseAlias(node *sitter.Node, source []byte) string {
+	for node != nil {
+		switch node.Type() {
+		case "call":
+			fnNode := node.ChildByFieldName("function")
+			args := node.ChildByFieldName("arguments")
+			if value, ok := stringLiteralValue(keywordArgument(args, "using", source), source); ok {
+				return value
+			}
+			if fnNode != nil && fnNode.Type() == "attribute" {
+				switch nodeText(source, fnNode.ChildByFieldName("attribute")) {
+				case "using", "db_manager":
+					if positional := positionalArguments(args); len(positional) > 0 {
+						if value, ok := stringLiteralValue(positional[0], source); ok {
+							return value
+						}
+					}
+				}
+			}
+			node = fnNode
+		case "attribute":
+			node = node.ChildByFieldName("object")
+		case "subscript":
+			value := node.ChildByFieldName("value")
+			if text := nodeText(source, value); text == "connections" || strings.HasSuffix(text, ".connections") {
+				if alias, ok := stringLiteralValue(node.ChildByFieldName("subscript"), source); ok {
+					return alias
+				}
+			}
+			node = value
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+type TransactionScope uint8
+
+const (
+	InTransaction TransactionScope = 1 << iota
+	OutsideTransaction
+)
+
+func (s TransactionScope) String() string {
+	switch s {
+	case InTransaction:
+		return "atomic"
+	case OutsideTransaction:
+		return "non-atomic"
+	case InTransaction | OutsideTransaction:
+		return "partly atomic"
+	}
+	return ""
+}
+
+func isTransactionCall(callee string) bool {
+	if idx := strings.LastIndex(callee, "."); idx >= 0 {
+		switch callee[idx+1:] {
+		case "atomic", "begin", "begin_nested":
+			return true
+		}
+		return false
+	}
+	return callee == "atomic"
+}
+
+func inTransaction(node *sitter.Node, functionNode *sitter.Node, source []byte) bool {
+	child := node
+	for parent := node.Parent(); parent != nil && parent != functionNode; child, parent = parent, parent.Parent() {
+		if parent.Type() != "with_statement" || child.Type() != "block" {
+			continue
+		}
+		opens := false
+		for i := 0; i < int(parent.NamedChildCount()); i++ {
+			clause := parent.NamedChild(i)
+			if clause.Type() == "block" {
+				continue
+			}
+			walk(clause, func(n *sitter.Node) {
+				if n.Type() == "call" && isTransactionCall(nodeText(source, n.ChildByFieldName("function"))) {
+					opens = true
+				}
+			})
+		}
+		if opens {
+			return true
+		}
+	}
+	for _, decorator := range functionDecorators(functionNode, source) {
+		if isTransactionCall(strings.TrimSpace(strings.SplitN(decorator, "(", 2)[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+type callbackArgument func(call *sitter.Node, source []byte) *sitter.Node
+
+func onCommitCallback(call *sitter.Node, source []byte) *sitter.Node {
+	callee := nodeText(source, call.ChildByFieldName("function"))
+	if callee != "on_commit" && !strings.HasSuffix(callee, ".on_commit") {
+		return nil
+	}
+	args := call.ChildByFieldName("arguments")
+	if callback := keywordArgument(args, "func", source); callback != nil {
+		return callback
+	}
+	if positional := positionalArguments(args); len(positional) > 0 {
+		return positional[0]
+	}
+	return nil
+}
+
+func inCallback(node *sitter.Node, functionNode *sitter.Node, source []byte, callback callbackArgument) bool {
+	for parent := node.Parent(); parent != nil && parent != functionNode; parent = parent.Parent() {
+		if parent.Type() != "lambda" {
+			continue
+		}
+		args := parent.Parent()
+		if args != nil && args.Type() == "keyword_argument" {
+			args = args.Parent()
+		}
+		if args == nil || args.Type() != "argument_list" {
+			continue
+		}
+		if call := args.Parent(); call != nil && call.Type() == "call" {
+			if arg := callback(call, source); arg != nil && arg.ID() == parent.ID() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func callbackTargets(functionNode *sitter.Node, source []byte, callback callbackArgument) []CallTarget {
+	targets := []CallTarget{}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "call" {
+			return
+		}
+		arg := callback(n, source)
+		if arg != nil && arg.Type() == "call" {
+			if callee := nodeText(source, arg.ChildByFieldName("function")); callee == "partial" || callee == "functools.partial" {
+				positional := positionalArguments(arg.ChildByFieldName("arguments"))
+				arg = nil
+				if len(positional) > 0 {
+					arg = positional[0]
+				}
+			}
+		}
+		if arg == nil {
+			return
+		}
+		switch arg.Type() {
+		case "identifier":
+			targets = append(targets, CallTarget{Kind: "name", Name: nodeText(source, arg), Node: n})
+		case "attribute":
+			obj := arg.ChildByFieldName("object")
+			attr := arg.ChildByFieldName("attribute")
+			if obj != nil && attr != nil && (obj.Type() == "identifier" || obj.Type() == "attribute") {
+				targets = append(targets, CallTarget{Kind: "attr", Base: nodeText(source, obj), Attr: nodeText(source, attr), Node: n})
+			}
+		}
+	})
+	return targets
+}
+
+func dependsCallback(call *sitter.Node, source []byte) *sitter.Node {
+	chain := attributeChain(call.ChildByFieldName("function"), source)
+	if len(chain) == 0 || (chain[len(chain)-1] != "Depends" && chain[len(chain)-1] != "Security") {
+		return nil
+	}
+	args := call.ChildByFieldName("arguments")
+	if dependency := keywordArgument(args, "dependency", source); dependency != nil {
+		return dependency
+	}
+	if positional := positionalArguments(args); len(positional) > 0 {
+		return positional[0]
+	}
+	return nil
+}
+
+func syncBoundaryCallback(call *sitter.Node, source []byte) *sitter.Node {
+	chain := attributeChain(call.ChildByFieldName("function"), source)
+	if len(chain) == 0 {
+		return nil
+	}
+	args := call.ChildByFieldName("arguments")
+	positional := positionalArguments(args)
+	switch chain[len(chain)-1] {
+	case "sync_to_async", "database_sync_to_async":
+		if callback := keywordArgument(args, "func", source); callback != nil {
+			return callback
+		}
+		if len(positional) > 0 {
+			return positional[0]
+		}
+	case "to_thread", "run_in_threadpool":
+		if len(positional) > 0 {
+			return positional[0]
+		}
+	case "run_in_executor":
+		if len(positional) > 1 {
+			return positional[1]
+		}
+	}
+	return nil
+}
+
+func isAsyncFunction(functionNode *sitter.Node) bool {
+	return functionNode.ChildCount() > 0 && functionNode.Child(0).Type() == "async"
+}
+
+func isSyncBoundaryDecorated(functionNode *sitter.Node, source []byte) bool {
+	for _, decorator := range functionDecorators(functionNode, source) {
+		name := strings.TrimSpace(strings.SplitN(decorator, "(", 2)[0])
+		if name = name[strings.LastIndex(name, ".")+1:]; name == "sync_to_async" || name == "database_sync_to_async" {
+			return true
+		}
+	}
+	return false
+}
+
+func isSyncQuery(op modelOperation) bool {
+	if op.Mode == 0 || strings.HasPrefix(op.Op, "session.") || strings.HasPrefix(op.Op, "sa.") {
+		return false
+	}
+	if parent := op.Call.Parent(); parent != nil && parent.Type() == "await" {
+		return false
+	}
+	if strings.HasPrefix(op.Op, "a") {
+		if _, ok := modelOperationModes[op.Op[1:]]; ok {
+			return false
+		}
+	}
+	if _, lazy := querySetOps[op.Op]; !lazy && op.Op != "values" && op.Op != "values_list" {
+		return true
+	}
+	parent := op.Call.Parent()
+	if parent == nil || (parent.Type() != "for_statement" && parent.Type() != "for_in_clause") || fieldName(parent, op.Call) != "right" {
+		return false
+	}
+	return parent.Child(0) == nil || parent.Child(0).Type() != "async"
+}
+
+type LintFinding struct {
+	Rule    string
+	File    string
+	Line    int
+	Message string
+	Chain   []string
+}
+
+type querySetLoop struct {
+	Node       *sitter.Node
+	Prefetched map[string]struct{}
+}
+
+func querySetLoopFinder(functionNode *sitter.Node, source []byte, ops []modelOperation, localTypes map[string]map[ClassRef]struct{}, isSQLAlchemyModel func(ModelRef) bool) func(*sitter.Node) *querySetLoop {
+	querySetCalls := map[uintptr]struct{}{}
+	for _, op := range ops {
+		if _, ok := querySetOps[op.Op]; ok || op.Op == "values" || op.Op == "values_list" {
+			querySetCalls[op.Call.ID()] = struct{}{}
+		}
+	}
+	assigned := map[string][]*sitter.Node{}
+	walk(functionNode, func(n *sitter.Node) {
+		if !isAssignmentNode(n) {
+			return
+		}
+		if left, right := assignmentSides(n); left != nil && right != nil && left.Type() == "identifier" {
+			name := nodeText(source, left)
+			assigned[name] = append(assigned[name], right)
+		}
+	})
+	isQueryChain := func(node *sitter.Node) bool {
+		call := unwrapCallNode(node)
+		if call == nil {
+			return false
+		}
+		if _, ok := querySetCalls[call.ID()]; ok {
+			return true
+		}
+		_, ok := relatedManagerQuery(call, source, localTypes, isSQLAlchemyModel)
+		return ok
+	}
+	iterableSources := func(iterable *sitter.Node) []*sitter.Node {
+		if iterable != nil && iterable.Type() == "identifier" {
+			return assigned[nodeText(source, iterable)]
+		}
+		return []*sitter.Node{iterable}
+	}
+	loops := map[uintptr]*querySetLoop{}
+	loopFor := func(loopNode *sitter.Node, iterables []*sitter.Node) *querySetLoop {
+		if loop, ok := loops[loopNode.ID()]; ok {
+			return loop
+		}
+		var loop *querySetLoop
+		for _, iterable := range iterables {
+			for _, expr := range iterableSources(iterable) {
+				if !isQueryChain(expr) {
+					continue
+				}
+				if loop == nil {
+					loop = &querySetLoop{Node: loopNode, Prefetched: map[string]struct{}{}}
+				}
+				walk(expr, func(n *sitter.Node) {
+					if n.Type() != "call" {
+						return
+					}
+					switch nodeText(source, n.ChildByFieldName("function")) {
+					case "Prefetch", "models.Prefetch":
+					default:
+						chain := attributeChain(n.ChildByFieldName("function"), source)
+						if len(chain) == 0 || (chain[len(chain)-1] != "select_related" && chain[len(chain)-1] != "prefetch_related") {
+							return
+						}
+					}
+					for _, arg := range positionalArguments(n.ChildByFieldName("arguments")) {
+						if value, ok := stringLiteralValue(arg, source); ok && value != "" {
+							loop.Prefetched[strings.Split(value, "__")[0]] = struct{}{}
+						}
+					}
+				})
+			}
+		}
+		loops[loopNode.ID()] = loop
+		return loop
+	}
+	return func(node *sitter.Node) *querySetLoop {
+		child := node
+		for parent := node.Parent(); parent != nil && parent != functionNode; child, parent = parent, parent.Parent() {
+			switch parent.Type() {
+			case "for_statement":
+				if fieldName(parent, child) != "body" {
+					continue
+				}
+				if loop := loopFor(parent, []*sitter.Node{parent.ChildByFieldName("right")}); loop != nil {
+					return loop
+				}
+			case "list_comprehension", "set_comprehension", "dictionary_comprehension", "generator_expression":
+				if child.Type() == "for_in_clause" {
+					continue
+				}
+				iterables := []*sitter.Node{}
+				for i := 0; i < int(parent.NamedChildCount()); i++ {
+					if clause := parent.NamedChild(i); clause.Type() == "for_in_clause" {
+						iterables = append(iterables, clause.ChildByFieldName("right"))
+					}
+				}
+				if loop := loopFor(parent, iterables); loop != nil {
+					return loop
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func relatedManagerQuery(call *sitter.Node, source []byte, localTypes map[string]map[ClassRef]struct{}, isSQLAlchemyModel func(ModelRef) bool) (string, bool) {
+	chain := attributeChain(call, source)
+	if len(chain) < 3 || chain[1] == "objects" {
+		return "", false
+	}
+	last := chain[len(chain)-1]
+	if _, ok := modelOperationModes[last]; !ok {
+		if _, ok := querySetOps[last]; !ok {
+			return "", false
+		}
+	}
+	for classRef := range localTypes[chain[0]] {
+		if isModelClass(isSQLAlchemyModel, classRef.Module, classRef.Name) {
+			return chain[1], true
+		}
+	}
+	return "", false
+}
+
+func loopQueries(functionNode *sitter.Node, source []byte, ops []modelOperation, localTypes map[string]map[ClassRef]struct{}, isSQLAlchemyModel func(ModelRef) bool, loopOf func(*sitter.Node) *querySetLoop) []*sitter.Node {
+	queries := []*sitter.Node{}
+	seen := map[uintptr]struct{}{}
+	for _, op := range ops {
+		if op.Mode == 0 {
+			continue
+		}
+		if _, ok := seen[op.Call.ID()]; !ok {
+			seen[op.Call.ID()] = struct{}{}
+			queries = append(queries, op.Call)
+		}
+	}
+	walk(functionNode, func(n *sitter.Node) {
+		if n.Type() != "call" || !isTerminalCall(n) {
+			return
+		}
+		if _, ok := seen[n.ID()]; ok {
+			return
+		}
+		accessor, ok := relatedManagerQuery(n, source, localTypes, isSQLAlchemyModel)
+		if !ok {
+			return
+		}
+		if chain := attributeChain(n, source); chain[len(chain)-1] == "all" {
+			if loop := loopOf(n); loop != nil {
+				if _, ok := loop.Prefetched[accessor]; ok {
+					return
+				}
+			}
+		}
+		seen[n.ID()] = struct{}{}
+		queries = append(queries, n)
+	})
+	return queries
+}
+
+func sourcePosition(moduleInfo *ModuleInfo, node *sitter.Node, root string) (string, int) {
+	path := moduleInfo.FilePath
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	return path, int(node.StartPoint().Row) + 1
+}
+
+func sourceLocation(moduleInfo *ModuleInfo, node *sitter.Node, root string) string {
+	path, line := sourcePosition(moduleInfo, node, root)
+	return fmt.Sprintf("%s:%d", path, line)
+}
+
+type TraceResult struct {
+	Models            map[ModelRef]struct{}
+	ModelUsage        map[ModelRef]map[string]AccessMode
+	NetworkModels     map[ModelRef]bool
+	ModelFields       map[ModelRef]map[string]struct{}
+	ModelTables       map[ModelRef]string
+	RawTables         map[string]map[string]AccessMode
+	ModelDatabases    map[ModelRef]map[string]AccessMode
+	RawTableDatabases map[string]map[string]AccessMode
+	WriteScopes       map[ModelRef]map[string]TransactionScope
+	Findings          []LintFinding
+	DTOs              map[ClassRef]string
+	DTOUsage          map[ClassRef]map[string]struct{}
+	Messages          map[ClassRef]MessageUse
+	MessageUsage      map[ClassRef]map[string]MessageUse
+	SideEffects       map[SideEffect]map[string]struct{}
+	Settings          map[SettingRef]map[string]struct{}
+}
+
+func newTraceResult() *TraceResult {
+	return &TraceResult{
+		Models:            map[ModelRef]struct{}{},
+		ModelUsage:        map[ModelRef]map[string]AccessMode{},
+		NetworkModels:     map[ModelRef]bool{},
+		ModelFields:       map[ModelRef]map[string]struct{}{},
+		ModelTables:       map[ModelRef]string{},
+		RawTables:         map[string]map[string]AccessMode{},
+		ModelDatabases:    map[ModelRef]map[string]AccessMode{},
+		RawTableDatabases: map[string]map[string]AccessMode{},
+		WriteScopes:       map[ModelRef]map[string]TransactionScope{},
+		DTOs:              map[ClassRef]string{},
+		DTOUsage:          map[ClassRef]map[string]struct{}{},
+		Messages:          map[ClassRef]MessageUse{},
+		MessageUsage:      map[ClassRef]map[string]MessageUse{},
+		SideEffects:       map[SideEffect]map[string]struct{}{},
+		Settings:          map[SettingRef]map[string]struct{}{},
+	}
+}
+
+type TraceOptions struct {
+	FollowRelations    bool
+	NPlusOne           bool
+	SyncInAsync        bool
+	DTOs               bool
+	Messages           bool
+	SideEffects        bool
+	SideEffectPatterns []sideEffectPattern
+	Settings           bool
+}
+
+type traceItem struct {
+	Key     [3]string
+	Note    string
+	Atomic  bool
+	InLoop  bool
+	InAsync bool
+}
+
+type traceContexts uint8
+
+const (
+	contextAtomic traceContexts = 1 << iota
+	contextNonAtomic
+	contextInLoop
+	contextInAsync
+)
+
+func (item traceItem) contexts() traceContexts {
+	contexts := contextNonAtomic
+	if item.Atomic {
+		contexts = contextAtomic
+	}
+	if item.InLoop {
+		contexts |= contextInLoop
+	}
+	if item.InAsync {
+		contexts |= contextInAsync
+	}
+	return contexts
+}
+
+func collectModelsForEntrypoint(entrypoint string, srcRoot string, options TraceOptions) (*TraceResult, []string) {
+	moduleMap, mapErrors := buildModuleMapForRoots(srcRoot)
+	if len(mapErrors) > 0 {
+		return newTraceResult(), mapErrors
+	}
+	return traceEntrypoint(entrypoint, srcRoot, moduleMap, newModuleLoader(moduleMap), options)
+}
+
+func traceEntrypoint(entrypoint string, srcRoot string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), options TraceOptions) (*TraceResult, []string) {
+	pathToModule := buildPathToModuleMap(moduleMap)
+	moduleSpec := entrypoint
+	entryObject := ""
+	if strings.Contains(entrypoint, ":") {
+		parts := strings.SplitN(entrypoint, ":", 2)
+		moduleSpec = parts[0]
+		entryObject = parts[1]
+	}
+	modulePath := moduleSpec
+	if resolved, ok := resolveEntrypointModule(moduleSpec, srcRoot, moduleMap, pathToModule); ok {
+		modulePath = resolved
+	}
+	if _, ok := moduleMap[modulePath]; !ok {
+		return newTraceResult(), []string{fmt.Sprintf("Module not found: %s", moduleSpec)}
+	}
+	entryClass := ""
+	entryMethod := ""
+	if entryObject != "" && strings.Contains(entryObject, "::") {
+		parts := strings.SplitN(entryObject, "::", 2)
+		entryClass = parts[0]
+		entryMethod = parts[1]
+		entryObject = ""
+	}
+
+	entryModule, err := getModuleInfo(modulePath)
+	if err != nil {
+		return newTraceResult(), []string{err.Error()}
+	}
+	seeds := getEntrySeeds(entryModule, entryObject, entryClass, entryMethod)
+	viewClass, viewAction := entryClass, ""
+	if entryClass == "" {
+		if _, ok := entryModule.Classes[entryObject]; ok {
+			viewClass = entryObject
+		}
+	} else if entryMethod != "" {
+		if len(seeds) > 0 {
+			viewClass = ""
+		}
+		viewAction = entryMethod
+	}
+	var view drfViewTrace
+	if viewClass != "" {
+		if trace, ok := traceDRFView(classDefinition{Info: entryModule, Name: viewClass}, viewAction, moduleMap, getModuleInfo); ok {
+			view = trace
+			seeds = append(seeds, view.Seeds...)
+		}
+	}
+	if len(seeds) == 0 && len(view.Usages) == 0 {
+		entryLabel := entryObject
+		if entryClass != "" {
+			if entryMethod != "" {
+				entryLabel = entryClass + "::" + entryMethod
+			} else {
+				entryLabel = entryClass
+			}
+		}
+		if entryLabel == "" {
+			entryLabel = "(module)"
+		}
+		return newTraceResult(), []string{fmt.Sprintf("Entrypoint object not found: %s in %s", entryLabel, modulePath)}
+	}
+
+	result := newTraceResult()
+	models := result.Models
+	modelUsage := result.ModelUsage
+	errors := []string{}
+	queue := make([]traceItem, 0, len(seeds))
+	visited := map[traceItem]traceContexts{}
+	addError := func(err string) {
+		if !containsString(errors, err) {
+			errors = append(errors, err)
+		}
+	}
+	chains := map[traceItem][]string{}
+	loopSites := map[traceItem]string{}
+	traceLabel := func(key [3]string) string {
+		return fmt.Sprintf("%s:%s%s", key[0], funcClassPrefix(key[1]), key[2])
+	}
+	for _, seed := range seeds {
+		item := traceItem{Key: seed}
+		queue = append(queue, item)
+		chains[item] = []string{traceLabel(seed)}
+	}
+	reportedFindings := map[string]struct{}{}
+	fieldCache := map[ModelRef]map[string]string{}
+	recordFields := func(model ModelRef, names []string, declaredOnly bool) {
+		fields, ok := fieldCache[model]
+		if !ok {
+			if def, ok := resolveClassDefinition(ClassRef{Module: model.Module, Name: model.Name}, moduleMap, getModuleInfo, 0); ok {
+				fields = collectModelFields(def, moduleMap, getModuleInfo, 0)
+			}
+			fieldCache[model] = fields
+		}
+		for _, name := range names {
+			if name == "" {
+				continue
+			}
+			if fields != nil {
+				if _, ok := fields[name]; !ok {
+					base := strings.TrimSuffix(name, "_id")
+					if fieldType, ok := fields[base]; ok && base != name && (strings.HasSuffix(fieldType, "ForeignKey") || fieldType == "OneToOneField") {
+						name = base
+					} else if name != "id" && name != "pk" {
+						continue
+					}
+				}
+			} else if declaredOnly {
+				continue
+			}
+			if _, ok := result.ModelFields[model]; !ok {
+				result.ModelFields[model] = map[string]struct{}{}
+			}
+			result.ModelFields[model][name] = struct{}{}
+		}
+	}
+	recordUsage := func(model ModelRef, usageKey string, mode AccessMode) {
+		models[model] = struct{}{}
+		if _, ok := modelUsage[model]; !ok {
+			modelUsage[model] = map[string]AccessMode{}
+		}
+		modelUsage[model][usageKey] |= mode
+	}
+	for model, usages := range view.Usages {
+		for usageKey, mode := range usages {
+			recordUsage(model, usageKey, mode)
+		}
+	}
+	var relations []ModelRelation
+	relationsBuilt := false
+	followRelated := func(model ModelRef, path []string, usageKey string) {
+		if !relationsBuilt {
+			relations = buildRelationGraph(moduleMap, getModuleInfo)
+			relationsBuilt = true
+		}
+		current := model
+		for _, accessor := range path {
+			next, ok := followRelation(relations, current, accessor, getModuleInfo)
+			if !ok {
+				return
+			}
+			for existing := range models {
+				if sameModel(existing, next, getModuleInfo) {
+					next = existing
+					break
+				}
+			}
+			recordUsage(next, fmt.Sprintf("%s (via %s.%s)", usageKey, current.Name, accessor), AccessRead)
+			current = next
+		}
+	}
+	var signalRegistry []SignalReceiver
+	signalRegistryBuilt := false
+	dtoKinds := map[ClassRef]string{}
+	sideEffectPatterns := append(append([]sideEffectPattern{}, defaultSideEffectPatterns...), options.SideEffectPatterns...)
+	var current traceItem
+	enqueue := func(item traceItem, note string, loopSite string) {
+		item.Note = note
+		item.InLoop = loopSite != ""
+		if item.contexts()&^visited[traceItem{Key: item.Key, Note: note}] == 0 {
+			return
+		}
+		if _, ok := chains[item]; !ok {
+			chain := append([]string{}, chains[current]...)
+			chains[item] = append(chain, traceLabel(item.Key))
+		}
+		if _, ok := loopSites[item]; !ok && loopSite != "" {
+			loopSites[item] = loopSite
+		}
+		queue = append(queue, item)
+	}
+
+	for len(queue) > 0 {
+		current = queue[0]
+		queue = queue[1:]
+		key := current.Key
+		moduleName := key[0]
+		className := key[1]
+		funcName := key[2]
+		if funcName == "" {
+			continue
+		}
+		edge := traceItem{Key: key, Note: current.Note}
+		seen, revisit := visited[edge]
+		if revisit && current.contexts()&^seen == 0 {
+			continue
+		}
+		visited[edge] = seen | current.contexts()
+
+		// protoc output builds its messages at runtime; there is nothing to trace.
+		if _, ok := moduleMap[moduleName]; !ok || isProtobufModule(moduleName) {
+			continue
+		}
+		moduleInfo, err := getModuleInfo(moduleName)
+		if err != nil {
+			addError(err.Error())
+			continue
+		}
+		var funcNodes []*sitter.Node
+		if className != "" {
+			if methods, ok := moduleInfo.Classes[className]; ok {
+				funcNodes = methods[funcName]
+			}
+		} else {
+			funcNodes = moduleInfo.Functions[funcName]
+		}
+		if len(funcNodes) == 0 {
+			addError(fmt.Sprintf("Function not found: %s:%s.%s", moduleName, className, funcName))
+			continue
+		}
+
+		usageKey := fmt.Sprintf("%s:%s%s", moduleInfo.ModulePath, funcClassPrefix(className), funcName)
+		if current.Note != "" {
+			usageKey += " (" + current.Note + ")"
+		}
+		scopeClass := className
+		if scopeClass == "" {
+			scopeClass = enclosingClassName(moduleInfo, funcName)
+		}
+		for _, funcNode := range funcNodes {
+			inAsync := (current.InAsync || isAsyncFunction(funcNode)) && !isSyncBoundaryDecorated(funcNode, moduleInfo.Source)
+			foundModels := analyzeFunctionModels(funcNode, moduleInfo, moduleMap)
+			for model := range foundModels {
+				recordUsage(model, usageKey, 0)
+			}
+
+			for ref, mode := range collectRawSQLTables(funcNode, moduleInfo.Source) {
+				if _, ok := result.RawTables[ref.Table]; !ok {
+					result.RawTables[ref.Table] = map[string]AccessMode{}
+				}
+				result.RawTables[ref.Table][usageKey] |= mode
+				if _, ok := result.RawTableDatabases[ref.Table]; !ok {
+					result.RawTableDatabases[ref.Table] = map[string]AccessMode{}
+				}
+				result.RawTableDatabases[ref.Table][ref.Alias] |= mode
+			}
+
+			if options.DTOs {
+				for _, def := range collectClassReferences(funcNode, moduleInfo, moduleMap, getModuleInfo) {
+					ref := ClassRef{Module: def.Info.ModulePath, Name: def.Name}
+					kind, ok := dtoKinds[ref]
+					if !ok {
+						kind, _ = dtoKind(def, moduleMap, getModuleInfo, 0)
+						dtoKinds[ref] = kind
+					}
+					if kind == "" {
+						continue
+					}
+					result.DTOs[ref] = kind
+					if _, ok := result.DTOUsage[ref]; !ok {
+						result.DTOUsage[ref] = map[string]struct{}{}
+					}
+					result.DTOUsage[ref][usageKey] = struct{}{}
+				}
+			}
+
+			if options.Messages {
+				for ref, use := range collectMessageReferences(funcNode, moduleInfo) {
+					result.Messages[ref] |= use
+					if _, ok := result.MessageUsage[ref]; !ok {
+						result.MessageUsage[ref] = map[string]MessageUse{}
+					}
+					result.MessageUsage[ref][usageKey] |= use
+				}
+			}
+
+			if options.SideEffects {
+				for effect := range collectSideEffects(funcNode, moduleInfo, sideEffectPatterns) {
+					if _, ok := result.SideEffects[effect]; !ok {
+						result.SideEffects[effect] = map[string]struct{}{}
+					}
+					result.SideEffects[effect][usageKey] = struct{}{}
+				}
+			}
+
+			if options.Settings {
+				for ref := range collectSettingsReads(funcNode, moduleInfo) {
+					if _, ok := result.Settings[ref]; !ok {
+						result.Settings[ref] = map[string]struct{}{}
+					}
+					result.Settings[ref][usageKey] = struct{}{}
+				}
+			}
+
+			localTypes := collectLocalVariableTypes(funcNode, moduleInfo, funcClassPrefix(className)+funcName, moduleMap, getModuleInfo)
+			if scopeClass != "" {
+				addLocalType(localTypes, "self", ClassRef{Module: moduleInfo.ModulePath, Name: scopeClass})
+			}
+			ops := collectModelOperations(funcNode, moduleInfo, moduleMap, localTypes)
+			loopOf := func(*sitter.Node) *querySetLoop { return nil }
+			if options.NPlusOne {
+				loopOf = querySetLoopFinder(funcNode, moduleInfo.Source, ops, localTypes, moduleInfo.IsSQLAlchemyModel)
+			}
+			loopSite := func(node *sitter.Node) string {
+				if current.InLoop {
+					return loopSites[current]
+				}
+				if loop := loopOf(node); loop != nil {
+					return sourceLocation(moduleInfo, loop.Node, srcRoot)
+				}
+				return ""
+			}
+			if options.NPlusOne {
+				for _, query := range loopQueries(funcNode, moduleInfo.Source, ops, localTypes, moduleInfo.IsSQLAlchemyModel, loopOf) {
+					site := loopSite(query)
+					if site == "" {
+						continue
+					}
+					file, line := sourcePosition(moduleInfo, query, srcRoot)
+					location := fmt.Sprintf("%s:%d", file, line)
+					queryText := strings.Join(strings.Fields(nodeText(moduleInfo.Source, query.ChildByFieldName("function"))), "") + "()"
+					if _, ok := reportedFindings[location+":"+queryText]; ok {
+						continue
+					}
+					reportedFindings[location+":"+queryText] = struct{}{}
+					result.Findings = append(result.Findings, LintFinding{
+						Rule:    "n-plus-one",
+						File:    file,
+						Line:    line,
+						Message: fmt.Sprintf("%s runs once per item of the queryset loop at %s", queryText, site),
+						Chain:   chains[current],
+					})
+				}
+			}
+
+			calls := analyzeFunctionCalls(funcNode, moduleInfo.Source)
+			calls = append(calls, analyzePropertyAccesses(funcNode, moduleInfo.Source)...)
+			// Callees stay in the caller's transaction unless they run after
+			// commit (on_commit callbacks) or in a worker (Celery tasks), and
+			// in its async context unless wrapped by sync_to_async and co.
+			for _, call := range calls {
+				deferred := inCallback(call.Node, funcNode, moduleInfo.Source, onCommitCallback)
+				next := traceItem{
+					Atomic:  !deferred && (current.Atomic || inTransaction(call.Node, funcNode, moduleInfo.Source)),
+					InAsync: inAsync && !inCallback(call.Node, funcNode, moduleInfo.Source, syncBoundaryCallback),
+				}
+				site := loopSite(call.Node)
+				targets := resolveCallTargets(call, moduleInfo, moduleMap, scopeClass, funcClassPrefix(className)+funcName, getModuleInfo, localTypes)
+				for _, target := range targets {
+					if target.Func == "" {
+						continue
+					}
+					if _, ok := moduleMap[target.Module]; !ok {
+						continue
+					}
+					next.Key = [3]string{target.Module, target.Class, target.Func}
+					if target.Async {
+						enqueue(traceItem{Key: next.Key}, "async", "")
+						continue
+					}
+					note := ""
+					if deferred {
+						note = "on_commit"
+					}
+					enqueue(next, note, site)
+				}
+			}
+			callbacks := []struct {
+				argument  callbackArgument
+				note      string
+				decorated bool
+			}{
+				{onCommitCallback, "on_commit", false},
+				{syncBoundaryCallback, "", false},
+				{dependsCallback, "Depends", true},
+			}
+			for _, callback := range callbacks {
+				scope := funcNode
+				if parent := funcNode.Parent(); callback.decorated && parent != nil && parent.Type() == "decorated_definition" {
+					scope = parent
+				}
+				for _, call := range callbackTargets(scope, moduleInfo.Source, callback.argument) {
+					next := traceItem{Atomic: current.Atomic || inTransaction(call.Node, funcNode, moduleInfo.Source)}
+					if callback.note == "on_commit" {
+						next = traceItem{InAsync: inAsync}
+					}
+					for _, target := range resolveCallTargets(call, moduleInfo, moduleMap, scopeClass, funcClassPrefix(className)+funcName, getModuleInfo, localTypes) {
+						if _, ok := moduleMap[target.Module]; ok && target.Func != "" {
+							next.Key = [3]string{target.Module, target.Class, target.Func}
+							enqueue(next, callback.note, loopSite(call.Node))
+						}
+					}
+				}
+			}
+
+			canonicalModel := func(model ModelRef) ModelRef {
+				for found := range foundModels {
+					if sameModel(found, model, getModuleInfo) {
+						return found
+					}
+				}
+				return model
+			}
+			for _, op := range ops {
+				model := canonicalModel(op.Model)
+				if _, ok := foundModels[model]; ok || op.Mode != 0 {
+					recordUsage(model, usageKey, op.Mode)
+				}
+				recordFields(model, operationFieldNames(op, moduleInfo.Source), false)
+				next := traceItem{
+					Atomic:  !inCallback(op.Call, funcNode, moduleInfo.Source, onCommitCallback) && (current.Atomic || inTransaction(op.Call, funcNode, moduleInfo.Source)),
+					InAsync: inAsync && !inCallback(op.Call, funcNode, moduleInfo.Source, syncBoundaryCallback),
+				}
+				site := loopSite(op.Call)
+				if options.SyncInAsync && next.InAsync && isSyncQuery(op) {
+					file, line := sourcePosition(moduleInfo, op.Call, srcRoot)
+					queryText := strings.Join(strings.Fields(nodeText(moduleInfo.Source, op.Call.ChildByFieldName("function"))), "") + "()"
+					if _, ok := reportedFindings[fmt.Sprintf("%s:%d:%s", file, line, queryText)]; !ok {
+						reportedFindings[fmt.Sprintf("%s:%d:%s", file, line, queryText)] = struct{}{}
+						result.Findings = append(result.Findings, LintFinding{
+							Rule:    "sync-orm-in-async",
+							File:    file,
+							Line:    line,
+							Message: fmt.Sprintf("%s queries synchronously in async code without sync_to_async", queryText),
+							Chain:   chains[current],
+						})
+					}
+				}
+				if op.Mode&AccessWrite != 0 {
+					scope := OutsideTransaction
+					if next.Atomic {
+						scope = InTransaction
+					}
+					if _, ok := result.WriteScopes[model]; !ok {
+						result.WriteScopes[model] = map[string]TransactionScope{}
+					}
+					result.WriteScopes[model][usageKey] |= scope
+				}
+				if op.Mode != 0 {
+					if _, ok := result.ModelDatabases[model]; !ok {
+						result.ModelDatabases[model] = map[string]AccessMode{}
+					}
+					result.ModelDatabases[model][databaseAlias(op.Call, funcNode, moduleInfo.Source)] |= op.Mode
+				}
+				if options.FollowRelations {
+					for _, path := range relatedModelPaths(op, moduleInfo.Source) {
+						followRelated(model, path, usageKey)
+					}
+				}
+				for _, target := range resolveModelOperationTargets(op, moduleMap, getModuleInfo) {
+					next.Key = [3]string{target.Module, target.Class, target.Func}
+					enqueue(next, "", site)
+				}
+				for _, target := range resolveLifecycleTargets(op, moduleMap, getModuleInfo) {
+					next.Key = [3]string{target.Module, target.Class, target.Func}
+					enqueue(next, "", site)
+				}
+				signals, ok := modelSignalOps[op.Op]
+				if !ok {
+					continue
+				}
+				if !signalRegistryBuilt {
+					signalRegistry = buildSignalRegistry(moduleMap, getModuleInfo)
+					signalRegistryBuilt = true
+				}
+				for _, receiver := range signalRegistry {
+					if !sameModel(receiver.Sender, op.Model, getModuleInfo) || !containsString(signals, receiver.Signal) {
+						continue
+					}
+					next.Key = [3]string{receiver.Target.Module, receiver.Target.Class, receiver.Target.Func}
+					enqueue(next, "signal "+receiver.Signal, site)
+				}
+			}
+			// Instance reads are kept once every model of the function is known,
+			// including those only recorded by its operations.
+			for model, names := range collectInstanceFieldReads(funcNode, moduleInfo.Source, localTypes, moduleInfo.IsSQLAlchemyModel) {
+				model = canonicalModel(model)
+				if _, ok := models[model]; ok {
+					recordFields(model, names, true)
+				}
+				if options.FollowRelations {
+					for _, name := range names {
+						followRelated(model, []string{name}, usageKey)
+					}
+				}
+			}
+		}
+	}
+
+	for model := range models {
+		bases := resolveModelBases(model, moduleMap, getModuleInfo, map[ModelRef]struct{}{})
+		if isNetworkModelBase(bases) {
+			result.NetworkModels[model] = true
+		}
+		if table, ok := resolveModelTable(model, moduleMap, getModuleInfo); ok {
+			result.ModelTables[model] = table
+		}
+		if _, ok := result.ModelDatabases[model]; !ok {
+			var mode AccessMode
+			for _, usageMode := range modelUsage[model] {
+				mode |= usageMode
+			}
+			result.ModelDatabases[model] = map[string]AccessMode{defaultDatabaseAlias: mode}
+		}
+	}
+
+	return result, errors
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func funcClassPrefix(className string) string {
+	if className == "" {
+		return ""
+	}
+	return className + "."
+}
+
+func nodeText(source []byte, node *sitter.Node) string {
+	if node == nil {
+		return ""
+	}
+	return string(source[node.StartByte():node.EndByte()])
+}
+
+func fieldName(parent *sitter.Node, child *sitter.Node) string {
+	if parent == nil || child == nil {
+		return ""
+	}
+	for i := 0; i < int(parent.ChildCount()); i++ {
+		if parent.Child(i).ID() == child.ID() {
+			return parent.FieldNameForChild(i)
+		}
+	}
+	return ""
+}
+
+func walk(node *sitter.Node, fn func(*sitter.Node)) {
+	if node == nil {
+		return
+	}
+	fn(node)
+	for i := 0; i < int(node.ChildCount()); i++ {
+		child := node.Child(i)
+		walk(child, fn)
+	}
+}
+
+// isNestedScope reports whether node is a def, class or lambda whose body does
+// not run as part of the enclosing function. Lambdas passed as arguments
+// (on_commit, sync_to_async) are callbacks and stay part of it.
+func isNestedScope(node *sitter.Node) bool {
+	switch node.Type() {
+	case "function_definition", "class_definition":
+		return true
+	case "lambda":
+		parent := node.Parent()
+		return parent == nil || (parent.Type() != "argument_list" && parent.Type() != "keyword_argument")
+	}
+	return false
+}
+
+func walkScope(root *sitter.Node, fn func(*sitter.Node)) {
+	var visit func(node *sitter.Node)
+	visit = func(node *sitter.Node) {
+		if node == nil || (node != root && isNestedScope(node)) {
+			return
+		}
+		fn(node)
+		for i := 0; i < int(node.ChildCount()); i++ {
+			visit(node.Child(i))
+		}
+	}
+	visit(root)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "relations" {
+		runRelations(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		runLint(os.Args[2:])
+		return
+	}
+	entrypoint := flag.String("entrypoint", "", "Entrypoint like 'pkg.module:MyClass' or 'src/path/file.py:MyClass::method'")
+	rootFlag := flag.String("root", "", "Python source root (base directory containing package roots).")
+	explain := flag.Bool("explain", false, "Print where each model is used (module:function).")
+	showFields := flag.Bool("fields", false, "Print the model fields accessed by the entrypoint.")
+	showTables := flag.Bool("tables", false, "Print database tables instead of models.")
+	showDatabases := flag.Bool("databases", false, "Group models by the database alias they are routed to.")
+	followRelations := flag.Bool("follow-relations", false, "Include models reached via select_related/prefetch_related and related-object access.")
+	showDTOs := flag.Bool("dtos", false, "Also list data-transfer schemas (pydantic, dataclass, attrs, TypedDict) the entrypoint references.")
+	showMessages := flag.Bool("messages", false, "Also list protobuf messages the entrypoint builds or references.")
+	showSideEffects := flag.Bool("side-effects", false, "Also list calls into external systems (HTTP, AWS, Redis, Kafka, SMTP).")
+	sideEffectPatternsFlag := flag.String("side-effect-patterns", "", "Extra side effect patterns as comma-separated prefix=kind, e.g. 'stripe=payments,myapp.sms.send=sms'.")
+	showSettings := flag.Bool("settings", false, "List the settings and environment variables the entrypoint reads instead of models.")
+	discover := flag.String("discover", "", "Trace every entrypoint of a kind found under --root instead of --entrypoint (grpc, routes, celery).")
+	djangoURLs := flag.String("django-urls", "", "Trace every view routed from this urlconf module instead of --entrypoint, e.g. 'myproject.urls'.")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "modex traces a Python entrypoint and lists referenced models from static analysis.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Usage:")
+		fmt.Fprintln(os.Stderr, "  modex --entrypoint <module-or-path[:object]> [--root <path>] [--explain] [--fields] [--tables] [--databases] [--follow-relations] [--dtos] [--messages] [--side-effects] [--settings]")
+		fmt.Fprintln(os.Stderr, "  modex --discover <kind> [--root <path>] [report flags]")
+		fmt.Fprintln(os.Stderr, "  modex --django-urls <urlconf-module> [--root <path>] [report flags]")
+		fmt.Fprintln(os.Stderr, "  modex relations [--root <path>] [--model <name>]")
+		fmt.Fprintln(os.Stderr, "  modex lint <rule> --entrypoint <module-or-path[:object]> [--root <path>]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 && *entrypoint == "" && *discover == "" && *djangoURLs == "" {
+		flag.Usage()
+		return
+	}
+
+	if *entrypoint == "" && *discover == "" && *djangoURLs == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --entrypoint is required")
+		os.Exit(2)
+	}
+
+	root := *rootFlag
+	if root == "" {
+		root = getRoot()
+	}
+	report := reportOptions{
+		Explain:   *explain,
+		Fields:    *showFields,
+		Tables:    *showTables,
+		Databases: *showDatabases,
+		DTOs:      *showDTOs,
+		Messages:  *showMessages,
+		Settings:  *showSettings,
+	}
+	options := TraceOptions{FollowRelations: *followRelations, DTOs: *showDTOs, Messages: *showMessages, Settings: *showSettings}
+	if *showSideEffects || *sideEffectPatternsFlag != "" {
+		patterns, err := parseSideEffectPatterns(*sideEffectPatternsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(2)
+		}
+		options.SideEffects = true
+		options.SideEffectPatterns = patterns
+		report.SideEffects = true
+	}
+	if *discover != "" {
+		runDiscover(*discover, root, options, report)
+		return
+	}
+	if *djangoURLs != "" {
+		runDjangoURLs(*djangoURLs, root, options, report)
+		return
+	}
+	result, errors := collectModelsForEntrypoint(*entrypoint, root, options)
+	if len(errors) > 0 {
+		for _, err := range errors {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+		os.Exit(2)
+	}
+	printReport(result, report)
+}
+
+type reportOptions struct {
+	Explain     bool
+	Fields      bool
+	Tables      bool
+	Databases   bool
+	DTOs        bool
+	Messages    bool
+	SideEffects bool
+	Settings    bool
+}
+
+func printReport(result *TraceResult, report reportOptions) {
+	if report.Tables {
+		printTables(result, report.Explain)
+		return
+	}
+	if report.Databases {
+		printDatabases(result)
+		return
+	}
+	if report.Settings {
+		printSettings(result, report.Explain)
+		return
+	}
+
+	modelList := make([]ModelRef, 0, len(result.Models))
+	for model := range result.Models {
+		modelList = append(modelList, model)
+	}
+	sort.Slice(modelList, func(i, j int) bool {
+		if modelList[i].Module == modelList[j].Module {
+			return modelList[i].Name < modelList[j].Name
+		}
+		return modelList[i].Module < modelList[j].Module
+	})
 
 	for _, model := range modelList {
 		label := model.String()
-		if modelBaseInfo[model] {
+		if result.NetworkModels[model] {
 			label = label + " (NetworkModel)"
 		}
-		if *explain {
-			fmt.Println(label)
-			usageSet := modelUsage[model]
-			usageList := make([]string, 0, len(usageSet))
-			for item := range usageSet {
-				usageList = append(usageList, item)
+		usageSet := result.ModelUsage[model]
+		var mode AccessMode
+		for _, usageMode := range usageSet {
+			mode |= usageMode
+		}
+		label = fmt.Sprintf("%s [%s]", label, mode)
+		fmt.Println(label)
+		if report.Fields {
+			fieldList := make([]string, 0, len(result.ModelFields[model]))
+			for field := range result.ModelFields[model] {
+				fieldList = append(fieldList, field)
+			}
+			sort.Strings(fieldList)
+			if len(fieldList) > 0 {
+				fmt.Printf("  fields: %s\n", strings.Join(fieldList, ", "))
+			}
+		}
+		if report.Explain {
+			usageList := make([]string, 0, len(usageSet))
+			for item := range usageSet {
+				usageList = append(usageList, item)
+			}
+			sort.Strings(usageList)
+			if len(usageList) == 0 {
+				fmt.Println("  - (unknown)")
+			} else {
+				for _, item := range usageList {
+					if scope := result.WriteScopes[model][item]; scope != 0 {
+						fmt.Printf("  - %s [%s, %s]\n", item, usageSet[item], scope)
+						continue
+					}
+					fmt.Printf("  - %s [%s]\n", item, usageSet[item])
+				}
+			}
+		}
+	}
+
+	rawTables := make([]string, 0, len(result.RawTables))
+	for table := range result.RawTables {
+		rawTables = append(rawTables, table)
+	}
+	sort.Strings(rawTables)
+	for _, table := range rawTables {
+		usageSet := result.RawTables[table]
+		var mode AccessMode
+		for _, usageMode := range usageSet {
+			mode |= usageMode
+		}
+		fmt.Printf("%s [%s] (raw SQL)\n", table, mode)
+		if report.Explain {
+			usageList := make([]string, 0, len(usageSet))
+			for item := range usageSet {
+				usageList = append(usageList, item)
+			}
+			sort.Strings(usageList)
+			for _, item := range usageList {
+				fmt.Printf("  - %s [%s]\n", item, usageSet[item])
+			}
+		}
+	}
+
+	if report.DTOs {
+		printDTOs(result, report.Explain)
+	}
+	if report.Messages {
+		printMessages(result, report.Explain)
+	}
+	if report.SideEffects {
+		printSideEffects(result, report.Explain)
+	}
+}
+
+func printMessages(result *TraceResult, explain bool) {
+	messageList := make([]ClassRef, 0, len(result.Messages))
+	for ref := range result.Messages {
+		messageList = append(messageList, ref)
+	}
+	sort.Slice(messageList, func(i, j int) bool {
+		if messageList[i].Module == messageList[j].Module {
+			return messageList[i].Name < messageList[j].Name
+		}
+		return messageList[i].Module < messageList[j].Module
+	})
+	for _, ref := range messageList {
+		fmt.Printf("%s.%s (message: %s)\n", ref.Module, ref.Name, result.Messages[ref])
+		if explain {
+			usages := map[string]struct{}{}
+			for item, use := range result.MessageUsage[ref] {
+				usages[fmt.Sprintf("%s [%s]", item, use)] = struct{}{}
+			}
+			printUsages(usages)
+		}
+	}
+}
+
+func printSettings(result *TraceResult, explain bool) {
+	sourceOrder := map[string]int{"setting": 0, "config": 1, "env": 2}
+	settingList := make([]SettingRef, 0, len(result.Settings))
+	for ref := range result.Settings {
+		settingList = append(settingList, ref)
+	}
+	sort.Slice(settingList, func(i, j int) bool {
+		if settingList[i].Source == settingList[j].Source {
+			return settingList[i].Key < settingList[j].Key
+		}
+		return sourceOrder[settingList[i].Source] < sourceOrder[settingList[j].Source]
+	})
+	for _, ref := range settingList {
+		fmt.Printf("%s (%s)\n", ref.Key, ref.Source)
+		if explain {
+			printUsages(result.Settings[ref])
+		}
+	}
+}
+
+func printSideEffects(result *TraceResult, explain bool) {
+	effectList := make([]SideEffect, 0, len(result.SideEffects))
+	for effect := range result.SideEffects {
+		effectList = append(effectList, effect)
+	}
+	sort.Slice(effectList, func(i, j int) bool {
+		if effectList[i].Call == effectList[j].Call {
+			return effectList[i].Target < effectList[j].Target
+		}
+		return effectList[i].Call < effectList[j].Call
+	})
+	for _, effect := range effectList {
+		if effect.Target != "" {
+			fmt.Printf("%s %q (side effect: %s)\n", effect.Call, effect.Target, effect.Kind)
+		} else {
+			fmt.Printf("%s (side effect: %s)\n", effect.Call, effect.Kind)
+		}
+		if explain {
+			printUsages(result.SideEffects[effect])
+		}
+	}
+}
+
+func printUsages(usages map[string]struct{}) {
+	usageList := make([]string, 0, len(usages))
+	for item := range usages {
+		usageList = append(usageList, item)
+	}
+	sort.Strings(usageList)
+	for _, item := range usageList {
+		fmt.Printf("  - %s\n", item)
+	}
+}
+
+type discoveredEntrypoint struct {
+	Entrypoint string
+	Label      string
+}
+
+type discoverer struct {
+	Find     func(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []discoveredEntrypoint
+	Messages bool
+}
+
+var discoverers = map[string]discoverer{
+	"grpc":   {Find: discoverServicerMethods, Messages: true},
+	"routes": {Find: discoverRoutes},
+	"celery": {Find: discoverCeleryTasks},
+}
+
+func runDiscover(kind string, root string, options TraceOptions, report reportOptions) {
+	found, ok := discoverers[kind]
+	if !ok {
+		kinds := make([]string, 0, len(discoverers))
+		for name := range discoverers {
+			kinds = append(kinds, name)
+		}
+		sort.Strings(kinds)
+		fmt.Fprintf(os.Stderr, "ERROR: unknown discover kind %q (supported: %s)\n", kind, strings.Join(kinds, ", "))
+		os.Exit(2)
+	}
+	moduleMap, mapErrors := buildModuleMapForRoots(root)
+	if len(mapErrors) > 0 {
+		for _, err := range mapErrors {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+		os.Exit(2)
+	}
+	if found.Messages {
+		options.Messages = true
+		report.Messages = true
+	}
+	getModuleInfo := newModuleLoader(moduleMap)
+	traceDiscovered(found.Find(moduleMap, getModuleInfo), root, moduleMap, getModuleInfo, options, report)
+}
+
+func runDjangoURLs(urlconf string, root string, options TraceOptions, report reportOptions) {
+	moduleMap, mapErrors := buildModuleMapForRoots(root)
+	if len(mapErrors) > 0 {
+		for _, err := range mapErrors {
+			fmt.Printf("ERROR: %s\n", err)
+		}
+		os.Exit(2)
+	}
+	if _, ok := moduleMap[urlconf]; !ok {
+		fmt.Printf("ERROR: urlconf module not found: %s\n", urlconf)
+		os.Exit(2)
+	}
+	getModuleInfo := newModuleLoader(moduleMap)
+	entrypoints, warnings := discoverDjangoURLs(urlconf, moduleMap, getModuleInfo)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", warning)
+	}
+	if len(entrypoints) == 0 {
+		fmt.Printf("ERROR: no views found from urlconf %s\n", urlconf)
+		os.Exit(2)
+	}
+	traceDiscovered(entrypoints, root, moduleMap, getModuleInfo, options, report)
+}
+
+func traceDiscovered(entrypoints []discoveredEntrypoint, root string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), options TraceOptions, report reportOptions) {
+	failed := false
+	for i, entry := range entrypoints {
+		if i > 0 {
+			fmt.Println()
+		}
+		header := "== " + entry.Entrypoint
+		if entry.Label != "" {
+			header += " (" + entry.Label + ")"
+		}
+		fmt.Println(header)
+		result, errors := traceEntrypoint(entry.Entrypoint, root, moduleMap, getModuleInfo, options)
+		if len(errors) > 0 {
+			for _, err := range errors {
+				fmt.Printf("ERROR: %s\n", err)
+			}
+			failed = true
+			continue
+		}
+		printReport(result, report)
+	}
+	if failed {
+		os.Exit(2)
+	}
+}
+
+func discoverServicerMethods(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []discoveredEntrypoint {
+	modulePaths := make([]string, 0, len(moduleMap))
+	for modulePath := range moduleMap {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	entrypoints := []discoveredEntrypoint{}
+	for _, modulePath := range modulePaths {
+		if strings.HasSuffix(modulePath, "_pb2_grpc") {
+			continue
+		}
+		content, err := os.ReadFile(moduleMap[modulePath])
+		if err != nil || !bytes.Contains(content, []byte("Servicer")) {
+			continue
+		}
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil {
+			continue
+		}
+		classNames := make([]string, 0, len(info.Classes))
+		for className := range info.Classes {
+			classNames = append(classNames, className)
+		}
+		sort.Strings(classNames)
+		for _, className := range classNames {
+			rpcs, ok := servicerRPCs(classDefinition{Info: info, Name: className}, moduleMap, getModuleInfo, 0)
+			if !ok {
+				continue
+			}
+			methods := make([]string, 0, len(info.Classes[className]))
+			for method := range info.Classes[className] {
+				if _, isRPC := rpcs[method]; strings.HasPrefix(method, "_") || (rpcs != nil && !isRPC) {
+					continue
+				}
+				methods = append(methods, method)
+			}
+			sort.Strings(methods)
+			for _, method := range methods {
+				entrypoints = append(entrypoints, discoveredEntrypoint{Entrypoint: fmt.Sprintf("%s:%s::%s", modulePath, className, method)})
+			}
+		}
+	}
+	return entrypoints
+}
+
+func servicerRPCs(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) (map[string]struct{}, bool) {
+	if depth > 8 {
+		return nil, false
+	}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		parent, inTree := resolveClassReference(base, def.Info, moduleMap, getModuleInfo)
+		full := importedName(base, def.Info)
+		if idx := strings.LastIndex(full, "."); idx > 0 && strings.HasSuffix(full[:idx], "_pb2_grpc") && strings.HasSuffix(full[idx+1:], "Servicer") {
+			if !inTree {
+				return nil, true
+			}
+			rpcs := map[string]struct{}{}
+			for method := range parent.Info.Classes[parent.Name] {
+				rpcs[method] = struct{}{}
+			}
+			return rpcs, true
+		}
+		if inTree && parent != def {
+			if rpcs, ok := servicerRPCs(parent, moduleMap, getModuleInfo, depth+1); ok {
+				return rpcs, true
+			}
+		}
+	}
+	return nil, false
+}
+
+var routeObjectClasses = map[string]string{
+	"flask.Flask":               "",
+	"flask.Blueprint":           "url_prefix",
+	"fastapi.FastAPI":           "",
+	"fastapi.APIRouter":         "prefix",
+	"fastapi.routing.APIRouter": "prefix",
+}
+
+var routeDecorators = map[string][]string{
+	"route":     nil,
+	"api_route": nil,
+	"get":       {"GET"},
+	"post":      {"POST"},
+	"put":       {"PUT"},
+	"patch":     {"PATCH"},
+	"delete":    {"DELETE"},
+	"head":      {"HEAD"},
+	"options":   {"OPTIONS"},
+	"websocket": {"WEBSOCKET"},
+}
+
+type routeObject struct {
+	Module string
+	Name   string
+}
+
+type routeMount struct {
+	Parent  routeObject
+	Prefix  string
+	Replace bool
+}
+
+func discoverRoutes(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []discoveredEntrypoint {
+	modulePaths := make([]string, 0, len(moduleMap))
+	for modulePath := range moduleMap {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+	infos := []*ModuleInfo{}
+	for _, modulePath := range modulePaths {
+		if info, err := getModuleInfo(modulePath); err == nil && info != nil && info.Tree != nil {
+			infos = append(infos, info)
+		}
+	}
+
+	objects := map[routeObject]string{}
+	for _, info := range infos {
+		root := info.Tree.RootNode()
+		for i := 0; i < int(root.NamedChildCount()); i++ {
+			statement := root.NamedChild(i)
+			if statement.Type() != "expression_statement" || statement.NamedChildCount() == 0 {
+				continue
 			}
-			sort.Strings(usageList)
-			if len(usageList) == 0 {
-				fmt.Println("  - (unknown)")
+			assignment := statement.NamedChild(0)
+			if assignment.Type() != "assignment" {
+				continue
+			}
+			left := assignment.ChildByFieldName("left")
+			right := assignment.ChildByFieldName("right")
+			if left == nil || right == nil || left.Type() != "identifier" || right.Type() != "call" {
+				continue
+			}
+			keyword, ok := routeObjectClasses[importedName(nodeText(info.Source, right.ChildByFieldName("function")), info)]
+			if !ok {
+				continue
+			}
+			prefix := ""
+			if keyword != "" {
+				prefix, _ = stringLiteralValue(keywordArgument(right.ChildByFieldName("arguments"), keyword, info.Source), info.Source)
+			}
+			objects[routeObject{Module: info.ModulePath, Name: nodeText(info.Source, left)}] = prefix
+		}
+	}
+	resolveObject := func(node *sitter.Node, info *ModuleInfo) (routeObject, bool) {
+		text := nodeText(info.Source, node)
+		if _, ok := objects[routeObject{Module: info.ModulePath, Name: text}]; ok {
+			return routeObject{Module: info.ModulePath, Name: text}, true
+		}
+		if full := importedName(text, info); strings.Contains(full, ".") {
+			ref := routeObject{Module: full[:strings.LastIndex(full, ".")], Name: full[strings.LastIndex(full, ".")+1:]}
+			if _, ok := objects[ref]; ok {
+				return ref, true
+			}
+		}
+		return routeObject{}, false
+	}
+
+	mounts := map[routeObject][]routeMount{}
+	for _, info := range infos {
+		walk(info.Tree.RootNode(), func(n *sitter.Node) {
+			if n.Type() != "call" {
+				return
+			}
+			fnNode := n.ChildByFieldName("function")
+			if fnNode == nil || fnNode.Type() != "attribute" {
+				return
+			}
+			keyword, replace := "", false
+			switch nodeText(info.Source, fnNode.ChildByFieldName("attribute")) {
+			case "register_blueprint":
+				keyword, replace = "url_prefix", true
+			case "include_router":
+				keyword = "prefix"
+			default:
+				return
+			}
+			args := n.ChildByFieldName("arguments")
+			positional := positionalArguments(args)
+			if len(positional) == 0 {
+				return
+			}
+			child, ok := resolveObject(positional[0], info)
+			if !ok {
+				return
+			}
+			mount := routeMount{}
+			if parent, ok := resolveObject(fnNode.ChildByFieldName("object"), info); ok {
+				mount.Parent = parent
+			}
+			if prefix, ok := stringLiteralValue(keywordArgument(args, keyword, info.Source), info.Source); ok {
+				mount.Prefix, mount.Replace = prefix, replace
+			}
+			mounts[child] = append(mounts[child], mount)
+		})
+	}
+	var prefixes func(object routeObject, depth int) []string
+	prefixes = func(object routeObject, depth int) []string {
+		own := objects[object]
+		if depth > 8 || len(mounts[object]) == 0 {
+			return []string{own}
+		}
+		found := []string{}
+		for _, mount := range mounts[object] {
+			local := mount.Prefix + own
+			if mount.Replace {
+				local = mount.Prefix
+			}
+			parents := []string{""}
+			if mount.Parent != (routeObject{}) {
+				parents = prefixes(mount.Parent, depth+1)
+			}
+			for _, parent := range parents {
+				found = append(found, parent+local)
+			}
+		}
+		return found
+	}
+
+	entrypoints := []discoveredEntrypoint{}
+	seen := map[discoveredEntrypoint]struct{}{}
+	for _, info := range infos {
+		names := make([]string, 0, len(info.Functions))
+		for name := range info.Functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, fn := range info.Functions[name] {
+				parent := fn.Parent()
+				if parent == nil || parent.Type() != "decorated_definition" {
+					continue
+				}
+				for i := 0; i < int(parent.NamedChildCount()); i++ {
+					decorator := parent.NamedChild(i)
+					if decorator.Type() != "decorator" || decorator.NamedChildCount() == 0 {
+						continue
+					}
+					call := decorator.NamedChild(0)
+					if call.Type() != "call" {
+						continue
+					}
+					fnNode := call.ChildByFieldName("function")
+					if fnNode == nil || fnNode.Type() != "attribute" {
+						continue
+					}
+					decoratorName := nodeText(info.Source, fnNode.ChildByFieldName("attribute"))
+					methods, ok := routeDecorators[decoratorName]
+					if !ok {
+						continue
+					}
+					object, resolved := resolveObject(fnNode.ChildByFieldName("object"), info)
+					if !resolved && decoratorName != "route" && decoratorName != "api_route" {
+						continue
+					}
+					args := call.ChildByFieldName("arguments")
+					path, ok := "", false
+					if positional := positionalArguments(args); len(positional) > 0 {
+						path, ok = stringLiteralValue(positional[0], info.Source)
+					} else if value := keywordArgument(args, "path", info.Source); value != nil {
+						path, ok = stringLiteralValue(value, info.Source)
+					} else {
+						path, ok = stringLiteralValue(keywordArgument(args, "rule", info.Source), info.Source)
+					}
+					if !ok {
+						continue
+					}
+					if methods == nil {
+						methods = []string{"GET"}
+						if list := keywordArgument(args, "methods", info.Source); list != nil && (list.Type() == "list" || list.Type() == "tuple") {
+							methods = []string{}
+							for j := 0; j < int(list.NamedChildCount()); j++ {
+								if method, ok := stringLiteralValue(list.NamedChild(j), info.Source); ok {
+									methods = append(methods, strings.ToUpper(method))
+								}
+							}
+						}
+					}
+					routePrefixes := []string{""}
+					if resolved {
+						routePrefixes = prefixes(object, 0)
+					}
+					for _, prefix := range routePrefixes {
+						entry := discoveredEntrypoint{
+							Entrypoint: info.ModulePath + ":" + name,
+							Label:      strings.Join(methods, ",") + " " + prefix + path,
+						}
+						if _, ok := seen[entry]; !ok {
+							seen[entry] = struct{}{}
+							entrypoints = append(entrypoints, entry)
+						}
+					}
+				}
+			}
+		}
+	}
+	return entrypoints
+}
+
+var celeryTaskBases = map[string]string{
+	"celery.Task":                   "task",
+	"celery.app.task.Task":          "task",
+	"celery.bootsteps.ConsumerStep": "consumer",
+}
+
+func celeryClassKind(def classDefinition, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error), depth int) string {
+	if depth > 8 {
+		return ""
+	}
+	for _, base := range def.Info.ClassBases[def.Name] {
+		full := importedName(base, def.Info)
+		if kind, ok := celeryTaskBases[full]; ok {
+			return kind
+		}
+		if parent, ok := resolveClassReference(base, def.Info, moduleMap, getModuleInfo); ok && parent != def {
+			if kind := celeryClassKind(parent, moduleMap, getModuleInfo, depth+1); kind != "" {
+				return kind
+			}
+			continue
+		}
+		if strings.HasSuffix(base, ".Task") {
+			return "task"
+		}
+	}
+	return ""
+}
+
+func celeryTaskName(node *sitter.Node, info *ModuleInfo, getModuleInfo func(string) (*ModuleInfo, error), qualified string) string {
+	if parent := node.Parent(); parent != nil && parent.Type() == "decorated_definition" {
+		for i := 0; i < int(parent.NamedChildCount()); i++ {
+			decorator := parent.NamedChild(i)
+			if decorator.Type() != "decorator" || decorator.NamedChildCount() == 0 || decorator.NamedChild(0).Type() != "call" {
+				continue
+			}
+			call := decorator.NamedChild(0)
+			if !isCeleryTaskDecorator(nodeText(info.Source, call), info, getModuleInfo) {
+				continue
+			}
+			if name, ok := stringLiteralValue(keywordArgument(call.ChildByFieldName("arguments"), "name", info.Source), info.Source); ok {
+				return name
+			}
+		}
+	}
+	return qualified
+}
+
+func celeryBeatSchedules(info *ModuleInfo, schedules map[string][]string) {
+	isScheduleName := func(name string) bool {
+		name = name[strings.LastIndex(name, ".")+1:]
+		return name == "beat_schedule" || strings.HasSuffix(name, "BEAT_SCHEDULE")
+	}
+	readSchedule := func(dict *sitter.Node) {
+		for i := 0; i < int(dict.NamedChildCount()); i++ {
+			pair := dict.NamedChild(i)
+			if pair.Type() != "pair" {
+				continue
+			}
+			entry, ok := stringLiteralValue(pair.ChildByFieldName("key"), info.Source)
+			value := pair.ChildByFieldName("value")
+			if !ok || value == nil {
+				continue
+			}
+			var task, schedule *sitter.Node
+			switch value.Type() {
+			case "dictionary":
+				for j := 0; j < int(value.NamedChildCount()); j++ {
+					field := value.NamedChild(j)
+					if field.Type() != "pair" {
+						continue
+					}
+					switch key, _ := stringLiteralValue(field.ChildByFieldName("key"), info.Source); key {
+					case "task":
+						task = field.ChildByFieldName("value")
+					case "schedule":
+						schedule = field.ChildByFieldName("value")
+					}
+				}
+			case "call":
+				if nodeText(info.Source, value.ChildByFieldName("function")) == "dict" {
+					args := value.ChildByFieldName("arguments")
+					task = keywordArgument(args, "task", info.Source)
+					schedule = keywordArgument(args, "schedule", info.Source)
+				}
+			}
+			name, ok := stringLiteralValue(task, info.Source)
+			if !ok {
+				continue
+			}
+			label := entry
+			if schedule != nil {
+				label += ": " + strings.Join(strings.Fields(nodeText(info.Source, schedule)), " ")
+			}
+			schedules[name] = append(schedules[name], label)
+		}
+	}
+	walk(info.Tree.RootNode(), func(n *sitter.Node) {
+		var name string
+		var value *sitter.Node
+		switch n.Type() {
+		case "assignment":
+			name, value = nodeText(info.Source, n.ChildByFieldName("left")), n.ChildByFieldName("right")
+		case "keyword_argument":
+			name, value = nodeText(info.Source, n.ChildByFieldName("name")), n.ChildByFieldName("value")
+		case "pair":
+			name, _ = stringLiteralValue(n.ChildByFieldName("key"), info.Source)
+			value = n.ChildByFieldName("value")
+		default:
+			return
+		}
+		if value != nil && value.Type() == "dictionary" && isScheduleName(name) {
+			readSchedule(value)
+		}
+	})
+}
+
+func discoverCeleryTasks(moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) []discoveredEntrypoint {
+	modulePaths := make([]string, 0, len(moduleMap))
+	for modulePath := range moduleMap {
+		modulePaths = append(modulePaths, modulePath)
+	}
+	sort.Strings(modulePaths)
+
+	type celeryEntrypoint struct {
+		Entrypoint string
+		Name       string
+	}
+	found := []celeryEntrypoint{}
+	schedules := map[string][]string{}
+	for _, modulePath := range modulePaths {
+		content, err := os.ReadFile(moduleMap[modulePath])
+		if err != nil {
+			continue
+		}
+		hasSchedule := bytes.Contains(content, []byte("beat_schedule")) || bytes.Contains(content, []byte("BEAT_SCHEDULE"))
+		if !hasSchedule && !bytes.Contains(content, []byte("task")) && !bytes.Contains(content, []byte("Task")) && !bytes.Contains(content, []byte("ConsumerStep")) {
+			continue
+		}
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil || info.Tree == nil {
+			continue
+		}
+		if hasSchedule {
+			celeryBeatSchedules(info, schedules)
+		}
+		names := make([]string, 0, len(info.Functions))
+		for name := range info.Functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			nodes := info.Functions[name]
+			if !isCeleryTask(nodes, info, getModuleInfo) {
+				continue
+			}
+			found = append(found, celeryEntrypoint{
+				Entrypoint: modulePath + ":" + name,
+				Name:       celeryTaskName(nodes[0], info, getModuleInfo, modulePath+"."+name),
+			})
+		}
+		classNames := make([]string, 0, len(info.Classes))
+		for className := range info.Classes {
+			classNames = append(classNames, className)
+		}
+		sort.Strings(classNames)
+		for _, className := range classNames {
+			def := classDefinition{Info: info, Name: className}
+			switch celeryClassKind(def, moduleMap, getModuleInfo, 0) {
+			case "task":
+				if _, ok := info.Classes[className]["run"]; !ok {
+					continue
+				}
+				name := modulePath + "." + className
+				if value, ok := info.ClassAttrs[className]["name"]; ok {
+					if literal, ok := stringLiteralValue(value, info.Source); ok {
+						name = literal
+					}
+				}
+				found = append(found, celeryEntrypoint{Entrypoint: fmt.Sprintf("%s:%s::run", modulePath, className), Name: name})
+			case "consumer":
+				found = append(found, celeryEntrypoint{Entrypoint: modulePath + ":" + className})
+			}
+		}
+	}
+
+	entrypoints := make([]discoveredEntrypoint, 0, len(found))
+	for _, entry := range found {
+		entrypoints = append(entrypoints, discoveredEntrypoint{
+			Entrypoint: entry.Entrypoint,
+			Label:      strings.Join(schedules[entry.Name], "; "),
+		})
+	}
+	return entrypoints
+}
+
+var djangoRouteFunctions = map[string]struct{}{
+	"django.urls.path":     {},
+	"django.urls.re_path":  {},
+	"django.conf.urls.url": {},
+}
+
+func moduleLevelValues(info *ModuleInfo, name string) []*sitter.Node {
+	if info.Tree == nil {
+		return nil
+	}
+	values := []*sitter.Node{}
+	root := info.Tree.RootNode()
+	for i := 0; i < int(root.NamedChildCount()); i++ {
+		statement := root.NamedChild(i)
+		if statement.Type() != "expression_statement" || statement.NamedChildCount() == 0 {
+			continue
+		}
+		assignment := statement.NamedChild(0)
+		if assignment.Type() != "assignment" && assignment.Type() != "augmented_assignment" {
+			continue
+		}
+		left := assignment.ChildByFieldName("left")
+		right := assignment.ChildByFieldName("right")
+		if left == nil || right == nil || nodeText(info.Source, left) != name {
+			continue
+		}
+		if assignment.Type() == "assignment" {
+			values = values[:0]
+		}
+		values = append(values, right)
+	}
+	return values
+}
+
+func joinRoute(prefix string, route string) string {
+	return prefix + strings.TrimSuffix(strings.TrimPrefix(route, "^"), "$")
+}
+
+func discoverDjangoURLs(urlconf string, moduleMap map[string]string, getModuleInfo func(string) (*ModuleInfo, error)) ([]discoveredEntrypoint, []string) {
+	entrypoints := []discoveredEntrypoint{}
+	warnings := []string{}
+	visiting := map[string]bool{}
+	add := func(entrypoint string, route string) {
+		entrypoints = append(entrypoints, discoveredEntrypoint{Entrypoint: entrypoint, Label: "/" + route})
+	}
+	unresolved := func(view string, route string) {
+		warnings = append(warnings, fmt.Sprintf("cannot resolve view %s of /%s", view, route))
+	}
+
+	var walkModule func(modulePath string, prefix string)
+	var walkPatterns func(node *sitter.Node, info *ModuleInfo, prefix string, depth int)
+	walkRouter := func(node *sitter.Node, info *ModuleInfo, prefix string) {
+		routerInfo, routerName := info, nodeText(info.Source, node)
+		if target, ok := info.FromImports[routerName]; ok {
+			targetInfo, err := getModuleInfo(target.Module)
+			if err != nil || targetInfo == nil {
+				return
+			}
+			routerInfo, routerName = targetInfo, target.Name
+		}
+		if routerInfo.Tree == nil {
+			return
+		}
+		root := routerInfo.Tree.RootNode()
+		for i := 0; i < int(root.NamedChildCount()); i++ {
+			statement := root.NamedChild(i)
+			if statement.Type() != "expression_statement" || statement.NamedChildCount() == 0 {
+				continue
+			}
+			call := statement.NamedChild(0)
+			if call.Type() != "call" || nodeText(routerInfo.Source, call.ChildByFieldName("function")) != routerName+".register" {
+				continue
+			}
+			positional := positionalArguments(call.ChildByFieldName("arguments"))
+			if len(positional) < 2 {
+				continue
+			}
+			route, ok := stringLiteralValue(positional[0], routerInfo.Source)
+			if !ok {
+				continue
+			}
+			route = joinRoute(prefix, strings.TrimSuffix(route, "/")+"/")
+			if def, ok := resolveClassReference(nodeText(routerInfo.Source, positional[1]), routerInfo, moduleMap, getModuleInfo); ok {
+				add(def.Info.ModulePath+":"+def.Name, route)
 			} else {
-				for _, item := range usageList {
-					fmt.Printf("  - %s\n", item)
+				unresolved(nodeText(routerInfo.Source, positional[1]), route)
+			}
+		}
+	}
+	walkInclude := func(node *sitter.Node, info *ModuleInfo, prefix string, depth int) {
+		if node.Type() == "tuple" && node.NamedChildCount() > 0 {
+			node = node.NamedChild(0)
+		}
+		if modulePath, ok := stringLiteralValue(node, info.Source); ok {
+			walkModule(modulePath, prefix)
+			return
+		}
+		if node.Type() == "identifier" || node.Type() == "attribute" {
+			if modulePath := importedName(nodeText(info.Source, node), info); modulePath != nodeText(info.Source, node) || node.Type() == "attribute" {
+				if _, ok := moduleMap[modulePath]; ok {
+					walkModule(modulePath, prefix)
+					return
 				}
 			}
-		} else {
-			fmt.Println(label)
+		}
+		walkPatterns(node, info, prefix, depth+1)
+	}
+	walkPatterns = func(node *sitter.Node, info *ModuleInfo, prefix string, depth int) {
+		if node == nil || depth > 16 {
+			return
+		}
+		switch node.Type() {
+		case "list", "tuple", "parenthesized_expression":
+			for i := 0; i < int(node.NamedChildCount()); i++ {
+				walkPatterns(node.NamedChild(i), info, prefix, depth+1)
+			}
+		case "binary_operator":
+			walkPatterns(node.ChildByFieldName("left"), info, prefix, depth+1)
+			walkPatterns(node.ChildByFieldName("right"), info, prefix, depth+1)
+		case "identifier":
+			patternsInfo, name := info, nodeText(info.Source, node)
+			if target, ok := info.FromImports[name]; ok {
+				targetInfo, err := getModuleInfo(target.Module)
+				if err != nil || targetInfo == nil {
+					return
+				}
+				patternsInfo, name = targetInfo, target.Name
+			}
+			for _, value := range moduleLevelValues(patternsInfo, name) {
+				walkPatterns(value, patternsInfo, prefix, depth+1)
+			}
+		case "attribute":
+			attr := nodeText(info.Source, node.ChildByFieldName("attribute"))
+			if attr == "urls" {
+				walkRouter(node.ChildByFieldName("object"), info, prefix)
+				return
+			}
+			modulePath := importedName(nodeText(info.Source, node.ChildByFieldName("object")), info)
+			if _, ok := moduleMap[modulePath]; !ok {
+				return
+			}
+			if targetInfo, err := getModuleInfo(modulePath); err == nil && targetInfo != nil {
+				for _, value := range moduleLevelValues(targetInfo, attr) {
+					walkPatterns(value, targetInfo, prefix, depth+1)
+				}
+			}
+		case "call":
+			callee := nodeText(info.Source, node.ChildByFieldName("function"))
+			positional := positionalArguments(node.ChildByFieldName("arguments"))
+			if _, ok := djangoRouteFunctions[importedName(callee, info)]; !ok && callee != "path" && callee != "re_path" && callee != "url" {
+				if len(positional) > 0 {
+					walkPatterns(positional[0], info, prefix, depth+1)
+				}
+				return
+			}
+			if len(positional) < 2 {
+				return
+			}
+			route, ok := stringLiteralValue(positional[0], info.Source)
+			if !ok {
+				return
+			}
+			route = joinRoute(prefix, route)
+			view := positional[1]
+			viewText := nodeText(info.Source, view)
+			for view.Type() == "call" {
+				viewFunc := view.ChildByFieldName("function")
+				viewArgs := positionalArguments(view.ChildByFieldName("arguments"))
+				switch {
+				case importedName(nodeText(info.Source, viewFunc), info) == "django.urls.include" || nodeText(info.Source, viewFunc) == "include":
+					if len(viewArgs) > 0 {
+						walkInclude(viewArgs[0], info, route, depth)
+					}
+					return
+				case viewFunc.Type() == "attribute" && nodeText(info.Source, viewFunc.ChildByFieldName("attribute")) == "as_view":
+					if def, ok := resolveClassReference(nodeText(info.Source, viewFunc.ChildByFieldName("object")), info, moduleMap, getModuleInfo); ok {
+						add(def.Info.ModulePath+":"+def.Name, route)
+					} else {
+						unresolved(viewText, route)
+					}
+					return
+				}
+				if len(viewArgs) == 0 {
+					unresolved(viewText, route)
+					return
+				}
+				view = viewArgs[0]
+			}
+			if view.Type() == "attribute" && nodeText(info.Source, view.ChildByFieldName("attribute")) == "urls" {
+				walkInclude(view, info, route, depth)
+				return
+			}
+			if resolved, _, ok := resolveFunctionReference(nodeText(info.Source, view), info, moduleMap, "", getModuleInfo); ok {
+				add(resolved.Module+":"+resolved.Func, route)
+			} else {
+				unresolved(viewText, route)
+			}
+		}
+	}
+	walkModule = func(modulePath string, prefix string) {
+		if visiting[modulePath] {
+			return
+		}
+		if _, ok := moduleMap[modulePath]; !ok {
+			return
+		}
+		info, err := getModuleInfo(modulePath)
+		if err != nil || info == nil {
+			return
+		}
+		visiting[modulePath] = true
+		defer delete(visiting, modulePath)
+		for _, value := range moduleLevelValues(info, "urlpatterns") {
+			walkPatterns(value, info, prefix, 0)
+		}
+	}
+	walkModule(urlconf, "")
+	return entrypoints, warnings
+}
+
+func printDTOs(result *TraceResult, explain bool) {
+	dtoList := make([]ClassRef, 0, len(result.DTOs))
+	for ref := range result.DTOs {
+		dtoList = append(dtoList, ref)
+	}
+	sort.Slice(dtoList, func(i, j int) bool {
+		if dtoList[i].Module == dtoList[j].Module {
+			return dtoList[i].Name < dtoList[j].Name
+		}
+		return dtoList[i].Module < dtoList[j].Module
+	})
+	for _, ref := range dtoList {
+		fmt.Printf("%s.%s (dto: %s)\n", ref.Module, ref.Name, result.DTOs[ref])
+		if explain {
+			printUsages(result.DTOUsage[ref])
+		}
+	}
+}
+
+func printTables(result *TraceResult, explain bool) {
+	tableModes := map[string]AccessMode{}
+	tableModels := map[string][]string{}
+	for model := range result.Models {
+		table, ok := result.ModelTables[model]
+		if !ok {
+			continue
+		}
+		var mode AccessMode
+		for _, usageMode := range result.ModelUsage[model] {
+			mode |= usageMode
+		}
+		tableModes[table] |= mode
+		tableModels[table] = append(tableModels[table], model.String())
+	}
+	for table, usageSet := range result.RawTables {
+		for item, mode := range usageSet {
+			tableModes[table] |= mode
+			tableModels[table] = append(tableModels[table], "raw SQL in "+item)
+		}
+	}
+	tables := make([]string, 0, len(tableModes))
+	for table := range tableModes {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("%s [%s]\n", table, tableModes[table])
+		if explain {
+			modelNames := tableModels[table]
+			sort.Strings(modelNames)
+			for _, name := range modelNames {
+				fmt.Printf("  - %s\n", name)
+			}
+		}
+	}
+}
+
+func printDatabases(result *TraceResult) {
+	entries := map[string][]string{}
+	for model, aliases := range result.ModelDatabases {
+		for alias, mode := range aliases {
+			entries[alias] = append(entries[alias], fmt.Sprintf("%s [%s]", model, mode))
+		}
+	}
+	for table, aliases := range result.RawTableDatabases {
+		for alias, mode := range aliases {
+			entries[alias] = append(entries[alias], fmt.Sprintf("%s [%s] (raw SQL)", table, mode))
+		}
+	}
+	aliases := make([]string, 0, len(entries))
+	for alias := range entries {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		fmt.Println(alias)
+		items := entries[alias]
+		sort.Strings(items)
+		for _, item := range items {
+			fmt.Printf("  %s\n", item)
 		}
 	}
 }
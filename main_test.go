@@ -0,0 +1,1554 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeTree writes Python sources, keyed by path relative to the root, to a
+// temporary directory and returns it.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// traceTree traces an entrypoint of a tree written by writeTree and fails the
+// test on trace errors.
+func traceTree(t *testing.T, files map[string]string, entrypoint string, options TraceOptions) *TraceResult {
+	t.Helper()
+	result, errors := collectModelsForEntrypoint(entrypoint, writeTree(t, files), options)
+	if len(errors) > 0 {
+		t.Fatalf("trace %s: %v", entrypoint, errors)
+	}
+	return result
+}
+
+// modelModes returns each traced model with its combined access mode.
+func modelModes(result *TraceResult) map[string]string {
+	modes := map[string]string{}
+	for model, usage := range result.ModelUsage {
+		var mode AccessMode
+		for _, usageMode := range usage {
+			mode |= usageMode
+		}
+		modes[model.String()] = mode.String()
+	}
+	return modes
+}
+
+// usageKeys returns the sorted usage keys of a model.
+func usageKeys(result *TraceResult, model string) []string {
+	keys := []string{}
+	for ref, usage := range result.ModelUsage {
+		if ref.String() != model {
+			continue
+		}
+		for key := range usage {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func assertModes(t *testing.T, result *TraceResult, want map[string]string) {
+	t.Helper()
+	if got := modelModes(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("models = %v, want %v", got, want)
+	}
+}
+
+func TestSQLAlchemyModelsArePerTree(t *testing.T) {
+	declarative := map[string]string{
+		"svc/__init__.py": "",
+		"svc/db.py": `from sqlalchemy.orm import declarative_base
+Base = declarative_base()
+
+class User(Base):
+    __tablename__ = "users"
+`,
+		"svc/api.py": `from svc.db import User
+
+def handle(session):
+    return session.get(User, 1)
+`,
+	}
+	plain := map[string]string{
+		"svc/__init__.py": "",
+		"svc/db.py": `class User:
+    pass
+`,
+		"svc/api.py": `from svc.db import User
+
+def handle(session):
+    return session.get(User, 1)
+`,
+	}
+	assertModes(t, traceTree(t, declarative, "svc.api:handle", TraceOptions{}), map[string]string{"svc.db.User": "r"})
+	assertModes(t, traceTree(t, plain, "svc.api:handle", TraceOptions{}), map[string]string{})
+}
+
+func TestSQLAlchemyModelCheck(t *testing.T) {
+	moduleMap, errors := buildModuleMapForRoots(writeTree(t, map[string]string{
+		"svc/__init__.py": "",
+		"svc/base.py": `from sqlalchemy.orm import DeclarativeBase, declarative_base
+from flask_sqlalchemy import SQLAlchemy
+
+class Base(DeclarativeBase):
+    pass
+
+Legacy = declarative_base()
+db = SQLAlchemy()
+`,
+		"svc/tables.py": `from svc.base import Base, Legacy, db
+
+class Timestamped(Base):
+    __abstract__ = True
+
+class User(Timestamped):
+    __tablename__ = "users"
+
+class Admin(User):
+    pass
+
+class Audit(Legacy):
+    __tablename__ = "audit"
+
+class Note(db.Model):
+    pass
+
+class Helper:
+    pass
+`,
+		"svc/unrelated.py": "class Other:\n    pass\n",
+	}))
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	load := newModuleLoader(moduleMap)
+	loaded := map[string]struct{}{}
+	isSQLAlchemyModel := newSQLAlchemyModelCheck(moduleMap, func(modulePath string) (*ModuleInfo, error) {
+		loaded[modulePath] = struct{}{}
+		return load(modulePath)
+	})
+	want := map[string]bool{
+		"Base": false, "Timestamped": false, "User": true, "Admin": true,
+		"Audit": true, "Note": true, "Helper": false,
+	}
+	for name, wantModel := range want {
+		if got := isSQLAlchemyModel(ModelRef{Module: "svc.tables", Name: name}); got != wantModel {
+			t.Errorf("isSQLAlchemyModel(%s) = %v, want %v", name, got, wantModel)
+		}
+	}
+	if _, ok := loaded["svc.unrelated"]; ok {
+		t.Errorf("svc.unrelated was parsed")
+	}
+}
+
+func TestSQLAlchemySessionReceivers(t *testing.T) {
+	files := map[string]string{
+		"svc/__init__.py": "",
+		"svc/db.py": `from sqlalchemy.orm import declarative_base
+Base = declarative_base()
+
+class User(Base):
+    __tablename__ = "users"
+`,
+		"svc/api.py": `from fastapi import Depends
+from sqlalchemy.orm import Session
+from sqlalchemy.ext.asyncio import AsyncSession
+from svc.db import User
+
+def read(db: Session = Depends(get_db)):
+    return db.query(User).first()
+
+def annotated(conn: Session):
+    return conn.query(User).first()
+
+async def create(uow: AsyncSession):
+    uow.add(User())
+
+def bound(engine):
+    with Session(engine) as s:
+        return s.get(User, 1)
+
+def not_a_session(cache):
+    return cache.get(User, 1)
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"svc.api:read", map[string]string{"svc.db.User": "r"}},
+		{"svc.api:annotated", map[string]string{"svc.db.User": "r"}},
+		{"svc.api:create", map[string]string{"svc.db.User": "w"}},
+		{"svc.api:bound", map[string]string{"svc.db.User": "r"}},
+		{"svc.api:not_a_session", map[string]string{"svc.db.User": "s"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestTraceEntrypointSharesLoader(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+
+class Refund(models.Model):
+    pass
+`,
+		"shop/views.py": `from shop.models import Order, Refund
+
+def orders():
+    return Order.objects.all()
+
+def refund(order_id):
+    Refund.objects.create(order_id=order_id)
+`,
+	})
+	moduleMap, errors := buildModuleMapForRoots(root)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	getModuleInfo := newModuleLoader(moduleMap)
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:orders", map[string]string{"shop.models.Order": "r"}},
+		{"shop.views:refund", map[string]string{"shop.models.Refund": "w"}},
+		{"shop.views:orders", map[string]string{"shop.models.Order": "r"}},
+	}
+	for _, tt := range tests {
+		result, errors := traceEntrypoint(tt.entrypoint, root, moduleMap, getModuleInfo, TraceOptions{})
+		if len(errors) > 0 {
+			t.Fatalf("trace %s: %v", tt.entrypoint, errors)
+		}
+		assertModes(t, result, tt.want)
+	}
+}
+
+func TestSQLTableReferences(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want map[string]AccessMode
+	}{
+		{"SELECT * FROM orders o JOIN customers c ON c.id = o.customer_id", map[string]AccessMode{"orders": AccessRead, "customers": AccessRead}},
+		{"INSERT INTO audit (id) SELECT id FROM orders", map[string]AccessMode{"audit": AccessWrite, "orders": AccessRead}},
+		{"DELETE FROM sessions WHERE expires < now()", map[string]AccessMode{"sessions": AccessWrite}},
+		{"SELECT * FROM a, b WHERE a.id = b.id", map[string]AccessMode{"a": AccessRead, "b": AccessRead}},
+		{"SELECT * FROM jobs FOR UPDATE NOWAIT", map[string]AccessMode{"jobs": AccessRead}},
+		{"SELECT * FROM jobs FOR UPDATE SKIP LOCKED", map[string]AccessMode{"jobs": AccessRead}},
+		{"SELECT * FROM jobs FOR UPDATE OF jobs", map[string]AccessMode{"jobs": AccessRead}},
+		{"SELECT EXTRACT(YEAR FROM created) FROM payments", map[string]AccessMode{"payments": AccessRead}},
+		{"SELECT SUBSTRING(name FROM 1 FOR 3), TRIM(LEADING ' ' FROM code) FROM items", map[string]AccessMode{"items": AccessRead}},
+		{"SELECT * FROM (SELECT id FROM orders) sub", map[string]AccessMode{"orders": AccessRead}},
+		{"INSERT INTO counters (id, n) VALUES (1, 1) ON DUPLICATE KEY UPDATE n = VALUES(n)", map[string]AccessMode{"counters": AccessWrite}},
+		{"INSERT INTO counters (id, n) VALUES (1, 1) ON CONFLICT (id) DO UPDATE SET n = excluded.n", map[string]AccessMode{"counters": AccessWrite}},
+		{"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", map[string]AccessMode{"orders": AccessRead}},
+		{"WITH totals (id, n) AS (SELECT id, n FROM lines) SELECT * FROM totals JOIN orders ON orders.id = totals.id", map[string]AccessMode{"lines": AccessRead, "orders": AccessRead}},
+		{"SELECT * FROM public.users u, accounts a WHERE u.id = a.user_id", map[string]AccessMode{"public.users": AccessRead, "accounts": AccessRead}},
+		{"SELECT * FROM users AS u, accounts WHERE u.id = accounts.user_id", map[string]AccessMode{"users": AccessRead, "accounts": AccessRead}},
+		{"SELECT * FROM orders WHERE paid IS DISTINCT FROM refunded", map[string]AccessMode{"orders": AccessRead}},
+		{"not sql at all", map[string]AccessMode{}},
+	}
+	for _, tt := range tests {
+		if got := sqlTableReferences(tt.sql); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sqlTableReferences(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+// sideEffectCalls returns the sorted calls and targets of traced side effects.
+func sideEffectCalls(result *TraceResult) []string {
+	calls := []string{}
+	for effect := range result.SideEffects {
+		call := effect.Call
+		if effect.Target != "" {
+			call += " " + effect.Target
+		}
+		calls = append(calls, call)
+	}
+	sort.Strings(calls)
+	return calls
+}
+
+func TestSideEffectClients(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "response is not a client",
+			body: `    resp = requests.get("https://api.example.com/x")
+    resp.raise_for_status()
+    return resp.json()
+`,
+			want: []string{"requests.get https://api.example.com/x"},
+		},
+		{
+			name: "session is a client",
+			body: `    http = requests.Session()
+    http.post("https://api.example.com/y")
+`,
+			want: []string{"requests.Session", "requests.Session.post https://api.example.com/y"},
+		},
+		{
+			name: "boto3 factory is a client",
+			body: `    s3 = boto3.client("s3")
+    s3.put_object(Bucket="b", Key="k")
+`,
+			want: []string{"boto3.client s3", "boto3.client.put_object s3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := traceTree(t, map[string]string{
+				"svc/__init__.py": "",
+				"svc/calls.py":    "import boto3\nimport requests\n\n\ndef run():\n" + tt.body,
+			}, "svc.calls:run", TraceOptions{SideEffects: true})
+			if got := sideEffectCalls(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("side effects = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverDjangoURLs(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"site/__init__.py": "",
+		"site/urls.py": `from django.contrib import admin
+from django.urls import path, include
+from django.views.decorators.csrf import csrf_exempt
+from app import views
+from app.urls import api_patterns
+
+urlpatterns = [
+    path("admin/", admin.site.urls),
+    path("idx/", csrf_exempt(views.index)),
+    path("api/", include(api_patterns)),
+    path("gone/", views.missing),
+]
+`,
+		"app/__init__.py": "",
+		"app/views.py": `def index(request):
+    pass
+
+def detail(request, pk):
+    pass
+`,
+		"app/urls.py": `from django.urls import path
+from app import views
+
+api_patterns = [
+    path("items/<int:pk>/", views.detail),
+]
+`,
+	})
+	moduleMap, errors := buildModuleMapForRoots(root)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	entrypoints, warnings := discoverDjangoURLs("site.urls", moduleMap, newModuleLoader(moduleMap))
+	want := []discoveredEntrypoint{
+		{Entrypoint: "app.views:index", Label: "/idx/"},
+		{Entrypoint: "app.views:detail", Label: "/api/items/<int:pk>/"},
+	}
+	if !reflect.DeepEqual(entrypoints, want) {
+		t.Errorf("entrypoints = %v, want %v", entrypoints, want)
+	}
+	if wantWarnings := []string{"cannot resolve view views.missing of /gone/"}; !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("warnings = %v, want %v", warnings, wantWarnings)
+	}
+}
+
+func TestRelationTargets(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Customer(models.Model):
+    name = models.CharField(max_length=50)
+
+class Order(models.Model):
+    customer = models.ForeignKey("Customer", on_delete=models.CASCADE)
+    parent = models.ForeignKey("self", on_delete=models.CASCADE)
+    billing = models.ForeignKey("billing.Customer", on_delete=models.CASCADE)
+    missing = models.ForeignKey("crm.Customer", on_delete=models.CASCADE)
+`,
+		"billing/__init__.py": "",
+		"billing/models.py": `from django.db import models
+
+class Customer(models.Model):
+    name = models.CharField(max_length=50)
+`,
+		"shop/serializers.py": `from rest_framework import serializers
+from shop.fields import ForeignKey
+
+class Customer(serializers.Serializer):
+    name = serializers.CharField()
+
+class OrderSerializer(serializers.Serializer):
+    customer = ForeignKey("Customer")
+    tags = serializers.ManyToManyField("Tag")
+`,
+	})
+	moduleMap, errors := buildModuleMapForRoots(root)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	targets := map[string]string{}
+	for _, relation := range buildRelationGraph(moduleMap, newModuleLoader(moduleMap)) {
+		targets[relation.From.String()+"."+relation.Field] = relation.To.String()
+	}
+	want := map[string]string{
+		"shop.models.Order.customer": "shop.models.Customer",
+		"shop.models.Order.parent":   "shop.models.Order",
+		"shop.models.Order.billing":  "billing.models.Customer",
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("relation targets = %v, want %v", targets, want)
+	}
+}
+
+func TestModuleAttributeConstructors(t *testing.T) {
+	files := map[string]string{
+		"app/__init__.py": "",
+		"app/schemas.py": `from pydantic import BaseModel
+
+class OrderIn(BaseModel):
+    id: int
+`,
+		"app/api.py": `from app import schemas
+
+def handle(data):
+    return schemas.OrderIn(**data)
+`,
+	}
+	result := traceTree(t, files, "app.api:handle", TraceOptions{DTOs: true})
+	want := map[ClassRef]string{{Module: "app.schemas", Name: "OrderIn"}: "pydantic"}
+	if !reflect.DeepEqual(result.DTOs, want) {
+		t.Errorf("dtos = %v, want %v", result.DTOs, want)
+	}
+}
+
+func TestFunctionAnalysedOncePerNewContext(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"shop/__init__.py": "",
+		"shop/helpers.py":  "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+`,
+		"shop/views.py": `from django.db import transaction
+from shop import helpers
+from shop.models import Order
+
+def save_order():
+    Order.objects.create()
+    helpers.missing()
+
+def run():
+    save_order()
+    save_order()
+    with transaction.atomic():
+        save_order()
+    for order in Order.objects.all():
+        save_order()
+`,
+	})
+	result, errors := collectModelsForEntrypoint("shop.views:run", root, TraceOptions{NPlusOne: true})
+	if want := []string{"Function not found: shop.helpers:.missing"}; !reflect.DeepEqual(errors, want) {
+		t.Errorf("errors = %v, want %v", errors, want)
+	}
+	order := ModelRef{Module: "shop.models", Name: "Order"}
+	if got, want := result.WriteScopes[order]["shop.views:save_order"], InTransaction|OutsideTransaction; got != want {
+		t.Errorf("write scopes = %v, want %v", got, want)
+	}
+}
+
+func TestCeleryTaskEdges(t *testing.T) {
+	models := `from django.db import models
+
+class Invoice(models.Model):
+    pass
+`
+	tests := []struct {
+		name  string
+		tasks string
+		view  string
+		want  []string
+	}{
+		{
+			name: "delay is async",
+			tasks: `from celery import shared_task
+from shop.models import Invoice
+
+@shared_task
+def send(pk):
+    Invoice.objects.get(pk=pk)
+`,
+			view: "    send.delay(1)\n",
+			want: []string{"shop.tasks:send (async)"},
+		},
+		{
+			name: "apply runs in process",
+			tasks: `from celery import shared_task
+from shop.models import Invoice
+
+@shared_task
+def send(pk):
+    Invoice.objects.get(pk=pk)
+`,
+			view: "    send.apply(args=(1,))\n",
+			want: []string{"shop.tasks:send"},
+		},
+		{
+			name: "direct and async edges are both listed",
+			tasks: `from celery import shared_task
+from shop.models import Invoice
+
+@shared_task
+def send(pk):
+    Invoice.objects.get(pk=pk)
+`,
+			view: "    send.delay(1)\n    send(2)\n",
+			want: []string{"shop.tasks:send", "shop.tasks:send (async)"},
+		},
+		{
+			name: "app task decorator",
+			tasks: `from shop.celery import app
+from shop.models import Invoice
+
+@app.task
+def send(pk):
+    Invoice.objects.get(pk=pk)
+`,
+			view: "    send.delay(1)\n",
+			want: []string{"shop.tasks:send (async)"},
+		},
+		{
+			name: "task attribute of something else",
+			tasks: `from shop import registry
+from shop.models import Invoice
+
+@registry.task
+def send(pk):
+    Invoice.objects.get(pk=pk)
+`,
+			view: "    send.delay(1)\n",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := traceTree(t, map[string]string{
+				"shop/__init__.py": "",
+				"shop/registry.py": "",
+				"shop/celery.py":   "from celery import Celery\n\napp = Celery(\"shop\")\n",
+				"shop/models.py":   models,
+				"shop/tasks.py":    tt.tasks,
+				"shop/views.py":    "from shop.tasks import send\n\n\ndef view():\n" + tt.view,
+			}, "shop.views:view", TraceOptions{})
+			if got := usageKeys(result, "shop.models.Invoice"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("usages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignalSenders(t *testing.T) {
+	tests := []struct {
+		name     string
+		receiver string
+		archive  bool
+		view     string
+		want     []string
+	}{
+		{
+			name: "re-exported sender",
+			receiver: `from django.db.models.signals import post_save
+from django.dispatch import receiver
+from shop.models import Order
+
+@receiver(post_save, sender=Order)
+def audit(sender, instance, **kwargs):
+    Log.objects.create()
+`,
+			want: []string{"shop.signals:audit (signal post_save)"},
+		},
+		{
+			name: "string sender",
+			receiver: `from django.db.models.signals import post_save
+from django.dispatch import receiver
+
+@receiver(post_save, sender="shop.Order")
+def audit(sender, instance, **kwargs):
+    Log.objects.create()
+`,
+			want: []string{"shop.signals:audit (signal post_save)"},
+		},
+		{
+			name: "same name in another module",
+			receiver: `from django.db.models.signals import post_save
+from django.dispatch import receiver
+from shop.models.archive import Order
+
+@receiver(post_save, sender=Order)
+def audit(sender, instance, **kwargs):
+    Log.objects.create()
+`,
+			archive: true,
+			want:    []string{},
+		},
+		{
+			name: "bulk_create sends no signals",
+			receiver: `from django.db.models.signals import post_save
+from django.dispatch import receiver
+from shop.models import Order
+
+@receiver(post_save, sender=Order)
+def audit(sender, instance, **kwargs):
+    Log.objects.create()
+`,
+			view: "from shop.models import Order\n\n\ndef place(orders):\n    Order.objects.bulk_create(orders)\n",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{
+				"shop/__init__.py":        "",
+				"shop/models/__init__.py": "from shop.models.orders import Order\nfrom shop.models.log import Log\n",
+				"shop/models/orders.py":   "from django.db import models\n\nclass Order(models.Model):\n    pass\n",
+				"shop/models/log.py":      "from django.db import models\n\nclass Log(models.Model):\n    pass\n",
+				"shop/signals.py":         "from shop.models import Log\n" + tt.receiver,
+				"shop/views.py":           "from shop.models import Order\n\n\ndef place():\n    Order.objects.create()\n",
+			}
+			if tt.view != "" {
+				files["shop/views.py"] = tt.view
+			}
+			if tt.archive {
+				files["shop/models/archive.py"] = "from django.db import models\n\nclass Order(models.Model):\n    pass\n"
+			}
+			result := traceTree(t, files, "shop.views:place", TraceOptions{})
+			if got := usageKeys(result, "shop.models.Log"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("usages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// modelFields returns the sorted fields recorded for a model.
+func modelFields(result *TraceResult, model string) []string {
+	fields := []string{}
+	for ref, names := range result.ModelFields {
+		if ref.String() != model {
+			continue
+		}
+		for name := range names {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestInstanceFieldReads(t *testing.T) {
+	models := `from django.db import models
+
+class Order(models.Model):
+    status = models.CharField(max_length=10)
+    total = models.IntegerField()
+`
+	tests := []struct {
+		name       string
+		files      map[string]string
+		entrypoint string
+		want       []string
+	}{
+		{
+			name: "assignments are not reads",
+			files: map[string]string{
+				"shop/views.py": `from shop.models import Order
+
+def pay(pk):
+    order = Order.objects.get(pk=pk)
+    order.status = "paid"
+    order.status, order.total = "paid", 0
+    return order.total
+`,
+			},
+			entrypoint: "shop.views:pay",
+			want:       []string{"pk", "total"},
+		},
+		{
+			name: "model recorded by a later operation",
+			files: map[string]string{
+				"shop/models.py": models + `
+
+def close(pk):
+    order = Order.objects.get(pk=pk)
+    return order.total
+`,
+			},
+			entrypoint: "shop.models:close",
+			want:       []string{"pk", "total"},
+		},
+		{
+			name: "chain on a model of the same module",
+			files: map[string]string{
+				"shop/models.py": models + `
+
+def recent():
+    return Order.objects.filter(status="open").values("total").count()
+`,
+			},
+			entrypoint: "shop.models:recent",
+			want:       []string{"status", "total"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"shop/__init__.py": "", "shop/models.py": models}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+			result := traceTree(t, files, tt.entrypoint, TraceOptions{})
+			if got := modelFields(result, "shop.models.Order"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalClasses(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+
+class Refund(models.Model):
+    pass
+`,
+		"shop/views.py": `from shop.models import Order, Refund
+
+class Loader:
+    def load(self):
+        return Refund.objects.all()
+
+def build():
+    class Loader:
+        def load(self):
+            return Order.objects.all()
+
+    def run():
+        return Loader().load()
+
+    loader = Loader()
+    loader.load()
+    return run()
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:build", map[string]string{"shop.models.Order": "r"}},
+		{"shop.views:build.<locals>.run", map[string]string{"shop.models.Order": "r"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestNestedDefinitionsNotCalled(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Invoice(models.Model):
+    pass
+
+class Receipt(models.Model):
+    pass
+
+class Audit(models.Model):
+    pass
+`,
+		"shop/signals.py": `from django.db.models.signals import post_save
+from django.dispatch import receiver
+from shop.models import Audit, Invoice
+
+@receiver(post_save, sender=Invoice)
+def audit(sender, instance, **kwargs):
+    Audit.objects.create()
+`,
+		"shop/views.py": `from django.db import transaction
+from shop.models import Invoice, Receipt
+
+def outer():
+    def never_called():
+        Invoice(total=1).save()
+
+    handler = lambda: Invoice.objects.all()
+    transaction.on_commit(lambda: Receipt.objects.create())
+
+class View:
+    def get(self):
+        class Local:
+            def load(self):
+                return Invoice.objects.all()
+        return None
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:outer", map[string]string{"shop.models.Receipt": "w"}},
+		{"shop.views:View::get", map[string]string{}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestPropertyAccessors(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+
+class Refund(models.Model):
+    pass
+`,
+		"shop/cart.py": `from shop.models import Order, Refund
+
+class BaseCart:
+    @property
+    def orders(self):
+        return Order.objects.all()
+
+    @orders.setter
+    def replace_orders(self, value):
+        Refund.objects.create()
+
+class Cart(BaseCart):
+    pass
+
+def read():
+    cart = Cart()
+    return cart.orders
+
+def write():
+    cart = Cart()
+    cart.orders = []
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.cart:read", map[string]string{"shop.models.Order": "r"}},
+		{"shop.cart:write", map[string]string{"shop.models.Refund": "w"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+// settingKeys returns the sorted "key (source)" settings of a trace.
+func settingKeys(result *TraceResult) []string {
+	keys := []string{}
+	for ref := range result.Settings {
+		keys = append(keys, ref.Key+" ("+ref.Source+")")
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSettingsReads(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "settings and environment",
+			src: `import os
+from django.conf import settings
+
+def run():
+    settings.DEBUG = True
+    os.getenv("HOME")
+    os.environ["TOKEN"]
+    return getattr(settings, "TIMEOUT", 5), settings.PAYMENT_URL
+`,
+			want: []string{"HOME (env)", "PAYMENT_URL (setting)", "TIMEOUT (setting)", "TOKEN (env)"},
+		},
+		{
+			name: "decouple config",
+			src: `from decouple import config
+
+def run():
+    return config("SECRET_KEY")
+`,
+			want: []string{"SECRET_KEY (config)"},
+		},
+		{
+			name: "config of another library",
+			src: `from app.conf import config
+
+def run():
+    return config("SECRET_KEY")
+`,
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := traceTree(t, map[string]string{
+				"app/__init__.py": "",
+				"app/conf.py":     "def config(key):\n    return key\n",
+				"app/jobs.py":     tt.src,
+			}, "app.jobs:run", TraceOptions{Settings: true})
+			if got := settingKeys(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("settings = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDRFViewActions(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+`,
+		"shop/serializers.py": `from rest_framework import serializers
+from shop.models import Order
+
+class OrderSerializer(serializers.ModelSerializer):
+    class Meta:
+        model = Order
+        fields = "__all__"
+`,
+		"shop/views.py": `from rest_framework import viewsets
+from shop.models import Order
+from shop.serializers import OrderSerializer
+
+class OrderViewSet(viewsets.ModelViewSet):
+    queryset = Order.objects.all()
+    serializer_class = OrderSerializer
+
+class ReadOrders(viewsets.ReadOnlyModelViewSet):
+    queryset = Order.objects.all()
+    serializer_class = OrderSerializer
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       string
+	}{
+		{"shop.views:OrderViewSet", "rw"},
+		{"shop.views:ReadOrders", "r"},
+		{"shop.views:OrderViewSet::create", "w"},
+		{"shop.views:OrderViewSet::list", "r"},
+	}
+	for _, tt := range tests {
+		result := traceTree(t, files, tt.entrypoint, TraceOptions{})
+		if got := modelModes(result)["shop.models.Order"]; got != tt.want {
+			t.Errorf("%s: Order mode = %q, want %q", tt.entrypoint, got, tt.want)
+		}
+	}
+}
+
+func TestConditionalDefinitions(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+
+class Refund(models.Model):
+    pass
+`,
+		"shop/compat.py": `from shop.models import Order, Refund
+
+try:
+    import ujson
+    def load():
+        return Order.objects.all()
+except ImportError:
+    def load():
+        return Refund.objects.all()
+
+class Store:
+    if True:
+        def save(self):
+            Order.objects.create()
+    else:
+        def save(self):
+            Refund.objects.create()
+
+def run():
+    load()
+    Store().save()
+`,
+	}
+	assertModes(t, traceTree(t, files, "shop.compat:run", TraceOptions{}), map[string]string{
+		"shop.models.Order":  "rw",
+		"shop.models.Refund": "rw",
+	})
+}
+
+func TestManagersAndModelMethods(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py":    "",
+		"billing/__init__.py": "",
+		"billing/models.py": `from django.db import models
+
+class Payment(models.Model):
+    pass
+
+class Audit(models.Model):
+    pass
+`,
+		"shop/models.py": `from django.db import models
+from billing.models import Audit, Payment
+
+class OrderQuerySet(models.QuerySet):
+    def active_for(self, user):
+        return Payment.objects.filter(user=user)
+
+class AuditManager(models.Manager):
+    def recent(self):
+        return Audit.objects.all()
+
+class Order(models.Model):
+    objects = OrderQuerySet.as_manager()
+    audits = AuditManager()
+
+    def mark_paid(self):
+        Payment.objects.create(order=self)
+`,
+		"shop/views.py": `from shop.models import Order
+
+def active(user):
+    return Order.objects.active_for(user)
+
+def recent():
+    return Order.audits.recent()
+
+def pay(pk):
+    order = Order.objects.get(pk=pk)
+    order.mark_paid()
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:active", map[string]string{"shop.models.Order": "r", "billing.models.Payment": "r"}},
+		{"shop.views:recent", map[string]string{"shop.models.Order": "r", "billing.models.Audit": "r"}},
+		{"shop.views:pay", map[string]string{"shop.models.Order": "r", "billing.models.Payment": "w"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestLifecycleOverrides(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py":      "",
+		"inventory/__init__.py": "",
+		"inventory/models.py": `from django.db import models
+
+class History(models.Model):
+    pass
+
+class Stock(models.Model):
+    pass
+`,
+		"shop/models.py": `from django.db import models
+from inventory.models import History, Stock
+
+class Tracked(models.Model):
+    def save(self, *args, **kwargs):
+        History.objects.create()
+        super().save(*args, **kwargs)
+
+    class Meta:
+        abstract = True
+
+class Order(Tracked):
+    def delete(self, *args, **kwargs):
+        Stock.objects.update(reserved=0)
+        super().delete(*args, **kwargs)
+`,
+		"shop/views.py": `from shop.models import Order
+
+def create():
+    Order.objects.create()
+
+def remove(pk):
+    order = Order.objects.get(pk=pk)
+    order.delete()
+
+def purge():
+    Order.objects.filter(stale=True).delete()
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:create", map[string]string{"shop.models.Order": "w", "inventory.models.History": "w"}},
+		{"shop.views:remove", map[string]string{"shop.models.Order": "rw", "inventory.models.Stock": "w"}},
+		// QuerySet.delete() does not call Model.delete().
+		{"shop.views:purge", map[string]string{"shop.models.Order": "w"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestAccessModes(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Invoice(models.Model):
+    pass
+
+class Customer(models.Model):
+    pass
+`,
+		"shop/views.py": `from shop.models import Customer, Invoice
+
+def show(pk):
+    return Invoice.objects.filter(pk=pk).exists()
+
+def issue():
+    Invoice.objects.create()
+
+def settle(pk):
+    invoice = Invoice.objects.get(pk=pk)
+    invoice.save()
+
+def check(obj):
+    return isinstance(obj, Customer)
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       map[string]string
+	}{
+		{"shop.views:show", map[string]string{"shop.models.Invoice": "r"}},
+		{"shop.views:issue", map[string]string{"shop.models.Invoice": "w"}},
+		{"shop.views:settle", map[string]string{"shop.models.Invoice": "rw"}},
+		{"shop.views:check", map[string]string{"shop.models.Customer": "s"}},
+	}
+	for _, tt := range tests {
+		assertModes(t, traceTree(t, files, tt.entrypoint, TraceOptions{}), tt.want)
+	}
+}
+
+func TestModelTables(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Invoice(models.Model):
+    class Meta:
+        db_table = "billing_invoice"
+
+class Customer(models.Model):
+    pass
+
+class VipCustomer(Customer):
+    class Meta:
+        proxy = True
+`,
+		"shop/alchemy.py": `from sqlalchemy.orm import declarative_base
+Base = declarative_base()
+
+class LineItem(Base):
+    __tablename__ = "line_items"
+`,
+		"shop/views.py": `from shop.alchemy import LineItem
+from shop.models import Customer, Invoice, VipCustomer
+
+def report(session):
+    Invoice.objects.all()
+    Customer.objects.all()
+    VipCustomer.objects.all()
+    session.query(LineItem).all()
+`,
+	}
+	result := traceTree(t, files, "shop.views:report", TraceOptions{})
+	got := map[string]string{}
+	for model, table := range result.ModelTables {
+		got[model.String()] = table
+	}
+	want := map[string]string{
+		"shop.models.Invoice":     "billing_invoice",
+		"shop.models.Customer":    "shop_customer",
+		"shop.models.VipCustomer": "shop_customer",
+		"shop.alchemy.LineItem":   "line_items",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tables = %v, want %v", got, want)
+	}
+}
+
+func TestModelDatabases(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Invoice(models.Model):
+    pass
+
+class Event(models.Model):
+    pass
+
+class Customer(models.Model):
+    pass
+
+class Payment(models.Model):
+    pass
+
+class Receipt(models.Model):
+    pass
+`,
+		"shop/views.py": `from django.db import transaction
+from shop.models import Customer, Event, Invoice, Payment, Receipt
+
+def report():
+    Invoice.objects.using("replica").filter(paid=True)
+    Event.objects.db_manager("analytics").create()
+    Customer.objects.get(pk=1)
+    with transaction.atomic(using="billing"):
+        Payment.objects.create()
+        transaction.on_commit(lambda: Receipt.objects.create())
+`,
+	}
+	result := traceTree(t, files, "shop.views:report", TraceOptions{})
+	got := map[string]map[string]string{}
+	for model, databases := range result.ModelDatabases {
+		got[model.String()] = map[string]string{}
+		for alias, mode := range databases {
+			got[model.String()][alias] = mode.String()
+		}
+	}
+	want := map[string]map[string]string{
+		"shop.models.Invoice":  {"replica": "r"},
+		"shop.models.Event":    {"analytics": "w"},
+		"shop.models.Customer": {"default": "r"},
+		"shop.models.Payment":  {"billing": "w"},
+		"shop.models.Receipt":  {"default": "w"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("databases = %v, want %v", got, want)
+	}
+}
+
+// findingLines returns each finding as "rule file:line".
+func findingLines(result *TraceResult) []string {
+	lines := []string{}
+	for _, finding := range result.Findings {
+		lines = append(lines, fmt.Sprintf("%s %s:%d", finding.Rule, finding.File, finding.Line))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestNPlusOneFindings(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+
+class Item(models.Model):
+    order = models.ForeignKey(Order, related_name="items", on_delete=models.CASCADE)
+`,
+		"shop/views.py": `from shop.models import Order
+
+def lazy():
+    for order in Order.objects.all():
+        print(list(order.items.all()))
+
+def prefetched():
+    for order in Order.objects.prefetch_related("items"):
+        print(list(order.items.all()))
+
+def helper(order):
+    return Order.objects.filter(pk=order.pk).count()
+
+def nested():
+    for order in Order.objects.all():
+        helper(order)
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       []string
+	}{
+		{"shop.views:lazy", []string{"n-plus-one shop/views.py:5"}},
+		{"shop.views:prefetched", []string{}},
+		{"shop.views:nested", []string{"n-plus-one shop/views.py:12"}},
+	}
+	for _, tt := range tests {
+		result := traceTree(t, files, tt.entrypoint, TraceOptions{NPlusOne: true})
+		if got := findingLines(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: findings = %v, want %v", tt.entrypoint, got, tt.want)
+		}
+	}
+}
+
+func TestSyncORMInAsync(t *testing.T) {
+	files := map[string]string{
+		"shop/__init__.py": "",
+		"shop/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+`,
+		"shop/views.py": `from asgiref.sync import sync_to_async
+from shop.models import Order
+
+def load(pk):
+    return Order.objects.get(pk=pk)
+
+async def direct(pk):
+    return Order.objects.get(pk=pk)
+
+async def native(pk):
+    return await Order.objects.aget(pk=pk)
+
+async def via_helper(pk):
+    return load(pk)
+
+async def wrapped(pk):
+    return await sync_to_async(load)(pk)
+
+def sync_view(pk):
+    return load(pk)
+`,
+	}
+	tests := []struct {
+		entrypoint string
+		want       []string
+	}{
+		{"shop.views:direct", []string{"sync-orm-in-async shop/views.py:8"}},
+		{"shop.views:native", []string{}},
+		{"shop.views:via_helper", []string{"sync-orm-in-async shop/views.py:5"}},
+		{"shop.views:wrapped", []string{}},
+		{"shop.views:sync_view", []string{}},
+	}
+	for _, tt := range tests {
+		result := traceTree(t, files, tt.entrypoint, TraceOptions{SyncInAsync: true})
+		if got := findingLines(result); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: findings = %v, want %v", tt.entrypoint, got, tt.want)
+		}
+	}
+}
+
+// discoverTree runs a discoverer's Find over a tree written by writeTree.
+func discoverTree(t *testing.T, files map[string]string, find func(map[string]string, func(string) (*ModuleInfo, error)) []discoveredEntrypoint) []discoveredEntrypoint {
+	t.Helper()
+	moduleMap, errors := buildModuleMapForRoots(writeTree(t, files))
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	return find(moduleMap, newModuleLoader(moduleMap))
+}
+
+func TestProtobufMessages(t *testing.T) {
+	files := map[string]string{
+		"svc/__init__.py":   "",
+		"svc/orders_pb2.py": "",
+		"svc/orders_pb2_grpc.py": `class OrdersServicer(object):
+    def GetOrder(self, request, context):
+        pass
+
+    def ListOrders(self, request, context):
+        pass
+`,
+		"svc/server.py": `from svc import orders_pb2, orders_pb2_grpc
+from svc.orders_pb2 import OrderReply
+
+class Orders(orders_pb2_grpc.OrdersServicer):
+    def GetOrder(self, request, context):
+        if request.status == orders_pb2.Status.PAID:
+            return OrderReply(id=request.id)
+        return orders_pb2.OrderReply()
+
+    def ListOrders(self, request, context):
+        if isinstance(request, orders_pb2.ListRequest):
+            pass
+
+    def helper(self):
+        pass
+`,
+	}
+	result := traceTree(t, files, "svc.server:Orders::GetOrder", TraceOptions{Messages: true})
+	got := map[string]string{}
+	for ref, use := range result.Messages {
+		got[ref.Module+"."+ref.Name] = use.String()
+	}
+	want := map[string]string{
+		"svc.orders_pb2.Status":     "referenced",
+		"svc.orders_pb2.OrderReply": "built",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %v, want %v", got, want)
+	}
+
+	entrypoints := discoverTree(t, files, discoverServicerMethods)
+	wantEntrypoints := []discoveredEntrypoint{
+		{Entrypoint: "svc.server:Orders::GetOrder"},
+		{Entrypoint: "svc.server:Orders::ListOrders"},
+	}
+	if !reflect.DeepEqual(entrypoints, wantEntrypoints) {
+		t.Errorf("entrypoints = %v, want %v", entrypoints, wantEntrypoints)
+	}
+}
+
+func TestDiscoverRoutes(t *testing.T) {
+	files := map[string]string{
+		"api/__init__.py": "",
+		"api/models.py": `from django.db import models
+
+class Order(models.Model):
+    pass
+`,
+		"api/deps.py": `from api.models import Order
+
+def current_order(pk: int):
+    return Order.objects.get(pk=pk)
+`,
+		"api/orders.py": `from fastapi import APIRouter, Depends
+from api.deps import current_order
+
+router = APIRouter(prefix="/orders")
+
+@router.get("/{pk}")
+def read(order=Depends(current_order)):
+    return order
+
+@router.api_route("/sync", methods=["put", "post"])
+def sync():
+    pass
+`,
+		"api/main.py": `from fastapi import FastAPI
+from api.orders import router
+
+app = FastAPI()
+app.include_router(router, prefix="/v1")
+`,
+		"web/__init__.py": "",
+		"web/views.py": `from flask import Blueprint
+
+bp = Blueprint("shop", __name__, url_prefix="/shop")
+
+@bp.route("/cart", methods=["GET", "POST"])
+def cart():
+    pass
+`,
+	}
+	entrypoints := discoverTree(t, files, discoverRoutes)
+	want := []discoveredEntrypoint{
+		{Entrypoint: "api.orders:read", Label: "GET /v1/orders/{pk}"},
+		{Entrypoint: "api.orders:sync", Label: "PUT,POST /v1/orders/sync"},
+		{Entrypoint: "web.views:cart", Label: "GET,POST /shop/cart"},
+	}
+	if !reflect.DeepEqual(entrypoints, want) {
+		t.Errorf("entrypoints = %v, want %v", entrypoints, want)
+	}
+	assertModes(t, traceTree(t, files, "api.orders:read", TraceOptions{}), map[string]string{"api.models.Order": "r"})
+}
+
+func TestDiscoverCeleryTasks(t *testing.T) {
+	files := map[string]string{
+		"worker/__init__.py": "",
+		"worker/celery.py": `from celery import Celery
+
+app = Celery("worker")
+app.conf.beat_schedule = {
+    "nightly-sync": {"task": "worker.tasks.sync", "schedule": 3600},
+    "cleanup": {"task": "jobs.cleanup", "schedule": 60},
+}
+`,
+		"worker/registry.py": `def task(fn):
+    return fn
+`,
+		"worker/tasks.py": `from celery import Task, bootsteps, shared_task
+from worker import registry
+from worker.celery import app
+
+@app.task
+def sync():
+    pass
+
+@shared_task(name="jobs.cleanup")
+def cleanup():
+    pass
+
+@registry.task
+def not_a_task():
+    pass
+
+class Report(Task):
+    name = "jobs.report"
+
+    def run(self):
+        pass
+
+class Listener(bootsteps.ConsumerStep):
+    pass
+`,
+	}
+	entrypoints := discoverTree(t, files, discoverCeleryTasks)
+	want := []discoveredEntrypoint{
+		{Entrypoint: "worker.tasks:cleanup", Label: "cleanup: 60"},
+		{Entrypoint: "worker.tasks:sync", Label: "nightly-sync: 3600"},
+		{Entrypoint: "worker.tasks:Listener"},
+		{Entrypoint: "worker.tasks:Report::run"},
+	}
+	if !reflect.DeepEqual(entrypoints, want) {
+		t.Errorf("entrypoints = %v, want %v", entrypoints, want)
+	}
+}